@@ -0,0 +1,209 @@
+package fast
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+// MissingLeafPolicy decides how aggregations treat leaves without a cell.
+type MissingLeafPolicy int
+
+const (
+	// MissingAsZero counts missing leaves as zero.
+	MissingAsZero MissingLeafPolicy = iota
+	// MissingAsError fails with ErrIncompleteAggregation, listing the
+	// coordinates of the missing leaves.
+	MissingAsError
+)
+
+// Rollup returns the sum of the cells of every leaf under consolidation
+// in dim, weighted by their component weights, with the cube's other
+// dimensions fixed at otherCoords, given in cube dimension order
+// without dim. A leaf reached through several paths counts once per
+// path, each time with the product of the weights on that path. Rollup
+// fails with ErrCyclicHierarchy on a cyclic hierarchy.
+func (s *Storage) Rollup(ctx context.Context, cube, dim, consolidation string, otherCoords ...string) (_ float64, err error) {
+	defer s.metrics.observe("Rollup", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return 0, err
+	}
+	pos := indexOf(c.Dimensions, dim)
+	if pos < 0 {
+		return 0, olap.ErrDimensionNotFound
+	}
+	if len(otherCoords) != len(c.Dimensions)-1 {
+		return 0, ErrInvalidCoordinate
+	}
+	return s.rollup(cube, pos, dim, consolidation, otherCoords)
+}
+
+// rollup implements Rollup for a dimension at position pos of cube.
+func (s *Storage) rollup(cube string, pos int, dim, consolidation string, otherCoords []string) (float64, error) {
+	key := rollupKey(cube, pos, dim, consolidation, otherCoords)
+	if v, ok := s.cachedRollup(key, cube, pos, otherCoords); ok {
+		return v, nil
+	}
+	// Read the versions before the data, so that a write racing with
+	// this rollup leaves a stale entry that is never used.
+	version := s.cells.version(cube, pos, otherCoords)
+	leaves, dims, err := s.elements.leaves(dim, consolidation)
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	missing := [][]string{}
+	for _, leaf := range leaves {
+		coord := coordinate(otherCoords, pos, leaf.name)
+		cell, err := s.cells.getCell(cube, coord...)
+		if err == olap.ErrCellNotFound {
+			missing = append(missing, coord)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum += leaf.weight * cell.Value
+	}
+	if len(missing) > 0 && s.missingLeaves == MissingAsError {
+		return 0, fmt.Errorf("%w: missing %v", ErrIncompleteAggregation, missing)
+	}
+	s.aggs.put(aggEntry{key: key, value: sum, cells: version, dims: dims})
+	return sum, nil
+}
+
+// AggResult is the aggregated value of one element sent by
+// StreamAggregated.
+type AggResult struct {
+	Element string
+	Value   float64
+	Err     error
+}
+
+// StreamAggregated sends the Rollup of every element of wildcardDim, in
+// ordinal order, with the cube's other dimensions fixed at fixed. The
+// channel is closed after the last element or once ctx is done, so
+// consumers that stop reading early must cancel ctx. The stream holds
+// its WithMaxConcurrency slot until the channel is closed.
+func (s *Storage) StreamAggregated(ctx context.Context, cube, wildcardDim string, fixed []string) (_ <-chan AggResult, err error) {
+	defer s.metrics.observe("StreamAggregated", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	pos := indexOf(c.Dimensions, wildcardDim)
+	if pos < 0 {
+		s.release()
+		return nil, olap.ErrDimensionNotFound
+	}
+	if len(fixed) != len(c.Dimensions)-1 {
+		s.release()
+		return nil, ErrInvalidCoordinate
+	}
+	fixed = append([]string{}, fixed...)
+	els := s.elements.list(wildcardDim)
+	results := make(chan AggResult)
+	go func() {
+		defer s.release()
+		defer close(results)
+		for _, el := range els {
+			v, err := s.rollup(cube, pos, wildcardDim, el.Name, fixed)
+			select {
+			case results <- AggResult{Element: el.Name, Value: v, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results, nil
+}
+
+// ChildValue is a child element with its Rollup, returned by
+// ChildrenWithValues.
+type ChildValue struct {
+	Element olap.Element
+	Value   float64
+}
+
+// ChildrenWithValues returns the children of parent in dim, as Children
+// does, each with its Rollup for the cube's other dimensions fixed at
+// fixed.
+func (s *Storage) ChildrenWithValues(ctx context.Context, cube, dim, parent string, fixed []string) (_ []ChildValue, err error) {
+	defer s.metrics.observe("ChildrenWithValues", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []ChildValue{}, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return []ChildValue{}, err
+	}
+	pos := indexOf(c.Dimensions, dim)
+	if pos < 0 {
+		return []ChildValue{}, olap.ErrDimensionNotFound
+	}
+	if len(fixed) != len(c.Dimensions)-1 {
+		return []ChildValue{}, ErrInvalidCoordinate
+	}
+	children, err := s.elements.children(dim, parent)
+	if err != nil {
+		return []ChildValue{}, err
+	}
+	values := make([]ChildValue, 0, len(children))
+	for _, child := range children {
+		v, err := s.rollup(cube, pos, dim, child.Name, fixed)
+		if err != nil {
+			return []ChildValue{}, err
+		}
+		values = append(values, ChildValue{Element: child, Value: v})
+	}
+	return values, nil
+}
+
+// CubeTotal returns the sum of every stored cell of cube.
+func (s *Storage) CubeTotal(ctx context.Context, cube string) (_ float64, err error) {
+	defer s.metrics.observe("CubeTotal", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	if _, err := s.cubes.getCube(cube); err != nil {
+		return 0, err
+	}
+	return s.cells.total(cube), nil
+}
+
+// without returns els without the element at pos.
+func without(els []string, pos int) []string {
+	others := make([]string, 0, len(els)-1)
+	others = append(others, els[:pos]...)
+	return append(others, els[pos+1:]...)
+}
+
+// coordinate returns others with el inserted at pos.
+func coordinate(others []string, pos int, el string) []string {
+	els := make([]string, 0, len(others)+1)
+	els = append(els, others[:pos]...)
+	els = append(els, el)
+	return append(els, others[pos:]...)
+}
+
+func indexOf(words []string, word string) int {
+	for i, w := range words {
+		if w == word {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,383 @@
+package fast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+func newRollupStorage(t *testing.T, opts ...Option) *Storage {
+	s := NewFastStorage(opts...)
+	ctx := context.Background()
+	els := []olap.Element{
+		{Dimension: "Product", Name: "vehicles"},
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Product", Name: "truck"},
+		{Dimension: "Region", Name: "north"},
+		{Dimension: "Region", Name: "south"},
+	}
+	for _, el := range els {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddComponent(ctx, els[0], els[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddComponent(ctx, els[0], els[2]); err != nil {
+		t.Fatal(err)
+	}
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Region", "Product"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"north", "car"}, Value: 10},
+		{Cube: "Sales", Elements: []string{"north", "truck"}, Value: 5},
+		{Cube: "Sales", Elements: []string{"south", "car"}, Value: 100},
+	}
+	for _, cell := range cells {
+		if err := s.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestRollup(t *testing.T) {
+	s := newRollupStorage(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		coord string
+		want  float64
+	}{
+		{"vehicles", "north", 15},
+		{"vehicles", "south", 100},
+		{"car", "north", 10},
+	}
+	for _, tt := range tests {
+		got, err := s.Rollup(ctx, "Sales", "Product", tt.name, tt.coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Rollup(%s, %s) = %v, want %v", tt.name, tt.coord, got, tt.want)
+		}
+	}
+
+	if _, err := s.Rollup(ctx, "Sales", "Product", "bikes", "north"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestMissingLeafPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	s := newRollupStorage(t, WithMissingLeafPolicy(MissingAsZero))
+	got, err := s.Rollup(ctx, "Sales", "Product", "vehicles", "south")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 100 {
+		t.Errorf("Rollup = %v, want 100", got)
+	}
+
+	s = newRollupStorage(t, WithMissingLeafPolicy(MissingAsError))
+	if _, err := s.Rollup(ctx, "Sales", "Product", "vehicles", "north"); err != nil {
+		t.Errorf("complete err = %v", err)
+	}
+	_, err = s.Rollup(ctx, "Sales", "Product", "vehicles", "south")
+	if !errors.Is(err, ErrIncompleteAggregation) {
+		t.Fatalf("err = %v, want %v", err, ErrIncompleteAggregation)
+	}
+	if want := "incomplete aggregation: missing [[south truck]]"; err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+}
+
+func TestCubeTotal(t *testing.T) {
+	s := newRollupStorage(t)
+	ctx := context.Background()
+
+	got, err := s.CubeTotal(ctx, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 115 {
+		t.Errorf("total = %v, want 115", got)
+	}
+
+	if err := s.ClearCube(ctx, "Sales"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.CubeTotal(ctx, "Sales"); err != nil || got != 0 {
+		t.Errorf("empty total = %v, %v, want 0", got, err)
+	}
+
+	if _, err := s.CubeTotal(ctx, "Costs"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+}
+
+func TestComponentWeight(t *testing.T) {
+	s := newRollupStorage(t)
+	ctx := context.Background()
+
+	w, err := s.GetComponentWeight(ctx, "Product", "vehicles", "Product", "truck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 1 {
+		t.Errorf("default weight = %v, want 1", w)
+	}
+
+	if err := s.SetComponentWeight(ctx, "Product", "vehicles", "Product", "truck", -1); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := s.GetComponentWeight(ctx, "Product", "vehicles", "Product", "truck"); w != -1 {
+		t.Errorf("weight = %v, want -1", w)
+	}
+	got, err := s.Rollup(ctx, "Sales", "Product", "vehicles", "north")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 5 {
+		t.Errorf("Rollup = %v, want 5", got)
+	}
+
+	if _, err := s.GetComponentWeight(ctx, "Product", "car", "Product", "truck"); err != olap.ErrComponentNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+	}
+	if err := s.SetComponentWeight(ctx, "Product", "car", "Product", "truck", 2); err != olap.ErrComponentNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+	}
+}
+
+func TestStreamAggregated(t *testing.T) {
+	s := newRollupStorage(t)
+	ctx := context.Background()
+
+	results, err := s.StreamAggregated(ctx, "Sales", "Product", []string{"north"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		got[r.Element] = r.Value
+	}
+	want := map[string]float64{"vehicles": 15, "car": 10, "truck": 5}
+	if len(got) != len(want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	for el, v := range want {
+		if got[el] != v {
+			t.Errorf("%s = %v, want %v", el, got[el], v)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	results, err = s.StreamAggregated(canceled, "Sales", "Product", []string{"north"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-results
+	cancel()
+	for range results {
+	}
+
+	if _, err := s.StreamAggregated(ctx, "Sales", "Month", []string{"north"}); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
+
+func TestChildrenWithValues(t *testing.T) {
+	s := newRollupStorage(t)
+	ctx := context.Background()
+
+	got, err := s.ChildrenWithValues(ctx, "Sales", "Product", "vehicles", []string{"north"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChildValue{
+		{Element: olap.Element{Dimension: "Product", Name: "car"}, Value: 10},
+		{Element: olap.Element{Dimension: "Product", Name: "truck"}, Value: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("values = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("values[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := s.ChildrenWithValues(ctx, "Sales", "Product", "car", []string{"north"}); err != olap.ErrComponentNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+	}
+	if _, err := s.ChildrenWithValues(ctx, "Sales", "Product", "vehicles", nil); err != ErrInvalidCoordinate {
+		t.Errorf("err = %v, want %v", err, ErrInvalidCoordinate)
+	}
+}
+
+func TestAggregationCache(t *testing.T) {
+	s := newRollupStorage(t, WithAggregationCache(true))
+	ctx := context.Background()
+	rollup := func(want float64) {
+		t.Helper()
+		got, err := s.Rollup(ctx, "Sales", "Product", "vehicles", "north")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Rollup = %v, want %v", got, want)
+		}
+	}
+
+	rollup(15)
+	// A write outside the rolled up slice keeps the cached value.
+	if err := s.AddCell(ctx, olap.Cell{Cube: "Sales", Elements: []string{"south", "truck"}, Value: 7}); err != nil {
+		t.Fatal(err)
+	}
+	rollup(15)
+	if s.aggs.hits != 1 {
+		t.Errorf("hits = %d, want 1", s.aggs.hits)
+	}
+
+	// A leaf write busts the cache.
+	if err := s.AddCell(ctx, olap.Cell{Cube: "Sales", Elements: []string{"north", "car"}, Value: 20}); err != nil {
+		t.Fatal(err)
+	}
+	rollup(25)
+	// So do weight and component changes.
+	if err := s.SetComponentWeight(ctx, "Product", "vehicles", "Product", "truck", -1); err != nil {
+		t.Fatal(err)
+	}
+	rollup(15)
+	if err := s.DetachElement(ctx, "Product", "truck"); err != nil {
+		t.Fatal(err)
+	}
+	rollup(20)
+	if s.aggs.hits != 1 {
+		t.Errorf("hits = %d, want 1", s.aggs.hits)
+	}
+	rollup(20)
+	if s.aggs.hits != 2 {
+		t.Errorf("hits = %d, want 2", s.aggs.hits)
+	}
+}
+
+func TestStreamAggregatedHoldsSlot(t *testing.T) {
+	s := newRollupStorage(t, WithMaxConcurrency(1))
+	ctx := context.Background()
+
+	results, err := s.StreamAggregated(ctx, "Sales", "Product", []string{"north"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream is blocked sending its second result.
+	<-results
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.GetCube(wctx, "Sales"); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	for range results {
+	}
+	if _, err := s.GetCube(ctx, "Sales"); err != nil {
+		t.Errorf("err = %v after the stream closed", err)
+	}
+}
+
+func TestRollupDiamond(t *testing.T) {
+	ctx := context.Background()
+	el := func(name string) olap.Element {
+		return olap.Element{Dimension: "Product", Name: name}
+	}
+	// all reaches x through left, with weights 1 and 3, and through
+	// right, with weights 2 and 1, so x weighs 1*3 + 2*1 = 5 in all.
+	edges := []struct {
+		parent, child string
+		weight        float64
+	}{
+		{"all", "left", 1},
+		{"all", "right", 2},
+		{"left", "x", 3},
+		{"right", "x", 1},
+		{"right", "y", 1},
+	}
+	build := func(reverse bool) *Storage {
+		s := newTestStorage()
+		addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+		for _, name := range []string{"all", "left", "right", "x", "y"} {
+			if err := s.AddElement(ctx, el(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range edges {
+			e := edges[i]
+			if reverse {
+				e = edges[len(edges)-1-i]
+			}
+			if err := s.AddComponent(ctx, el(e.parent), el(e.child)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetComponentWeight(ctx, "Product", e.parent, "Product", e.child, e.weight); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, c := range []olap.Cell{
+			{Cube: "Sales", Elements: []string{"x"}, Value: 10},
+			{Cube: "Sales", Elements: []string{"y"}, Value: 1},
+		} {
+			if err := s.AddCell(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+
+	for _, reverse := range []bool{false, true} {
+		s := build(reverse)
+		if got, err := s.Rollup(ctx, "Sales", "Product", "all"); err != nil || got != 52 {
+			t.Errorf("reverse=%v: Rollup = %v, %v, want 52", reverse, got, err)
+		}
+	}
+
+	s := build(false)
+	if err := s.AddComponent(ctx, el("x"), el("all")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Rollup(ctx, "Sales", "Product", "all"); err != ErrCyclicHierarchy {
+		t.Errorf("err = %v, want %v", err, ErrCyclicHierarchy)
+	}
+}
+
+func TestAggCacheEviction(t *testing.T) {
+	c := newAggCache(2)
+	for _, key := range []string{"a", "b"} {
+		c.put(aggEntry{key: key})
+	}
+	c.get("a")
+	c.put(aggEntry{key: "c"})
+	if n := c.len(); n != 2 {
+		t.Errorf("len = %d, want 2", n)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %s evicted", key)
+		}
+	}
+}
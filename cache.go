@@ -0,0 +1,110 @@
+package fast
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// aggCacheSize is the number of rollups an aggregation cache keeps.
+const aggCacheSize = 4096
+
+// aggCache memoizes rollups, evicting the least recently used beyond
+// size. Each entry keeps the version of the slice of cells it summed
+// and of the dimensions its hierarchy walk visited; it's valid while
+// none of them changed. A nil *aggCache caches nothing.
+type aggCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List // of *aggEntry, most recently used first
+	hits    int
+}
+
+type aggEntry struct {
+	key   string
+	value float64
+	cells uint64
+	dims  map[string]uint64
+}
+
+func newAggCache(size int) *aggCache {
+	return &aggCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *aggCache) get(key string) (aggEntry, bool) {
+	if c == nil {
+		return aggEntry{}, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return aggEntry{}, false
+	}
+	c.lru.MoveToFront(e)
+	return *e.Value.(*aggEntry), true
+}
+
+func (c *aggCache) put(e aggEntry) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if old, ok := c.entries[e.key]; ok {
+		*old.Value.(*aggEntry) = e
+		c.lru.MoveToFront(old)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(&e)
+	if c.lru.Len() > c.size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.entries, last.Value.(*aggEntry).key)
+	}
+}
+
+func (c *aggCache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+func (c *aggCache) hit() {
+	c.Lock()
+	defer c.Unlock()
+	c.hits++
+}
+
+// rollupKey identifies a rollup in the aggregation cache.
+func rollupKey(cube string, pos int, dim, consolidation string, otherCoords []string) string {
+	return hash(sliceKey(cube, pos, otherCoords), dim, consolidation)
+}
+
+// sliceKey identifies the cells of cube at others, with any element at
+// position pos.
+func sliceKey(cube string, pos int, others []string) string {
+	return hash(cube, strconv.Itoa(pos), hash(others...))
+}
+
+// cachedRollup returns the cached rollup for key if the slice of cube
+// at otherCoords and the hierarchies it was computed from haven't
+// changed since.
+func (s *Storage) cachedRollup(key, cube string, pos int, otherCoords []string) (float64, bool) {
+	e, ok := s.aggs.get(key)
+	if !ok || s.cells.version(cube, pos, otherCoords) != e.cells {
+		return 0, false
+	}
+	for d, v := range s.elements.version(e.dims) {
+		if e.dims[d] != v {
+			return 0, false
+		}
+	}
+	s.aggs.hit()
+	return e.value, true
+}
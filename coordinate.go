@@ -0,0 +1,58 @@
+package fast
+
+import (
+	"context"
+
+	"github.com/aclivo/olap"
+)
+
+// Coordinate builds the elements of a cell by dimension name, so they
+// don't have to be given in the cube's dimension order.
+type Coordinate struct {
+	cube     olap.Cube
+	elements []string
+	set      []bool
+}
+
+// NewCoordinate returns an empty coordinate of cube.
+func NewCoordinate(cube olap.Cube) *Coordinate {
+	return &Coordinate{
+		cube:     copyCube(cube),
+		elements: make([]string, len(cube.Dimensions)),
+		set:      make([]bool, len(cube.Dimensions)),
+	}
+}
+
+// Set assigns element to dimension. A dimension can only be set once.
+func (c *Coordinate) Set(dimension, element string) error {
+	i := indexOf(c.cube.Dimensions, dimension)
+	if i < 0 {
+		return &KeyError{Op: "set coordinate", Dim: dimension, Name: element, Err: olap.ErrDimensionNotFound}
+	}
+	if c.set[i] {
+		return &KeyError{Op: "set coordinate", Dim: dimension, Name: element, Err: ErrDimensionAlreadySet}
+	}
+	c.elements[i] = element
+	c.set[i] = true
+	return nil
+}
+
+// Elements returns the elements in the cube's dimension order. Every
+// dimension must have been set.
+func (c *Coordinate) Elements() ([]string, error) {
+	for i, ok := range c.set {
+		if !ok {
+			return []string{}, &KeyError{Op: "build coordinate", Dim: c.cube.Dimensions[i], Err: ErrDimensionNotSet}
+		}
+	}
+	return append([]string{}, c.elements...), nil
+}
+
+// GetCellAt returns the cell at coord.
+func (s *Storage) GetCellAt(ctx context.Context, coord *Coordinate) (olap.Cell, error) {
+	els, err := coord.Elements()
+	if err != nil {
+		return olap.Cell{}, err
+	}
+	return s.GetCell(ctx, coord.cube.Name, els...)
+}
@@ -0,0 +1,48 @@
+package fast
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func TestCoordinate(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Month"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	cell := olap.Cell{Cube: "Sales", Elements: []string{"car", "Jan"}, Value: 1}
+	if err := s.AddCell(ctx, cell); err != nil {
+		t.Fatal(err)
+	}
+
+	coord := NewCoordinate(cube)
+	if err := coord.Set("Month", "Jan"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetCellAt(ctx, coord); !errors.Is(err, ErrDimensionNotSet) {
+		t.Errorf("unset err = %v, want %v", err, ErrDimensionNotSet)
+	}
+	if err := coord.Set("Product", "car"); err != nil {
+		t.Fatal(err)
+	}
+	if err := coord.Set("Month", "Feb"); !errors.Is(err, ErrDimensionAlreadySet) {
+		t.Errorf("duplicate err = %v, want %v", err, ErrDimensionAlreadySet)
+	}
+	if err := coord.Set("Region", "north"); !errors.Is(err, olap.ErrDimensionNotFound) {
+		t.Errorf("unknown err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+
+	c, err := s.GetCellAt(ctx, coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Value != 1 {
+		t.Errorf("value = %v, want 1", c.Value)
+	}
+}
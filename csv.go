@@ -0,0 +1,105 @@
+package fast
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+// valueColumn is the header of the value column in CSV files.
+const valueColumn = "Value"
+
+// ExportCSV writes the cells of cube to w as CSV, with a header of the
+// cube dimensions followed by a value column.
+func (s *Storage) ExportCSV(ctx context.Context, cube string, w io.Writer) (err error) {
+	defer s.metrics.observe("ExportCSV", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{}
+	s.cells.rangeCells(cube, func(cell olap.Cell) bool {
+		row := append([]string{}, cell.Elements...)
+		row = append(row, strconv.FormatFloat(cell.Value, 'g', -1, 64))
+		rows = append(rows, row)
+		return true
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		return hash(rows[i]...) < hash(rows[j]...)
+	})
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(c.Dimensions, valueColumn)); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// ImportCSV adds a cell to cube for every row read from r. The first row
+// must name the cube dimensions, in any order, followed by a value
+// column. Rows are read one at a time and errors report their line.
+// Because rows are added as they are read, the import isn't atomic: on
+// error, the rows before the failing line stay added.
+func (s *Storage) ImportCSV(ctx context.Context, cube string, r io.Reader) (err error) {
+	defer s.metrics.observe("ImportCSV", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return err
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(c.Dimensions) + 1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("line 1: %w", err)
+	}
+	// pos maps a cube dimension to its column.
+	pos := make([]int, len(c.Dimensions))
+	for i, dim := range c.Dimensions {
+		pos[i] = indexOf(header[:len(c.Dimensions)], dim)
+		if pos[i] < 0 {
+			return fmt.Errorf("line 1: %w", &KeyError{Op: "import csv", Dim: dim, Err: olap.ErrDimensionNotFound})
+		}
+	}
+	for line := 2; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		cell := olap.Cell{Cube: cube, Elements: make([]string, len(c.Dimensions))}
+		for i, dim := range c.Dimensions {
+			el := row[pos[i]]
+			if _, err := s.elements.getElement(dim, el); err != nil {
+				return fmt.Errorf("line %d: %w", line, &KeyError{Op: "import csv", Dim: dim, Name: el, Err: err})
+			}
+			cell.Elements[i] = el
+		}
+		if cell.Value, err = strconv.ParseFloat(row[len(row)-1], 64); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := s.cells.addCell(cell); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func newCSVStorage(t *testing.T) *Storage {
+	s := newTestStorage()
+	ctx := context.Background()
+	els := []olap.Element{
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Product", Name: "truck"},
+		{Dimension: "Month", Name: "Jan"},
+		{Dimension: "Month", Name: "Feb"},
+	}
+	for _, el := range els {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Month"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	src := newCSVStorage(t)
+	ctx := context.Background()
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car", "Jan"}, Value: 1.5},
+		{Cube: "Sales", Elements: []string{"car", "Feb"}, Value: 2},
+		{Cube: "Sales", Elements: []string{"truck", "Jan"}, Value: -3},
+	}
+	for _, cell := range cells {
+		if err := src.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := src.ExportCSV(ctx, "Sales", &buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := newCSVStorage(t)
+	if err := dst.ImportCSV(ctx, "Sales", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := dst.cells.count("Sales"); n != len(cells) {
+		t.Errorf("count = %d, want %d", n, len(cells))
+	}
+	for _, want := range cells {
+		got, err := dst.GetCell(ctx, "Sales", want.Elements...)
+		if err != nil || got.Value != want.Value {
+			t.Errorf("cell %v = %v, %v, want %v", want.Elements, got.Value, err, want.Value)
+		}
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Month,Product,Value\nJan,car,abc\n", "line 2: "},
+		{"Product,Month,Value\ncar,Jan,1\nbike,Jan,2\n", "line 3: "},
+		{"Product,Region,Value\ncar,north,1\n", "line 1: "},
+	}
+	for _, tt := range tests {
+		s := newCSVStorage(t)
+		err := s.ImportCSV(ctx, "Sales", strings.NewReader(tt.in))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("err = %v, want prefix %q", err, tt.want)
+		}
+	}
+}
+
+func TestImportCSVPartial(t *testing.T) {
+	s := newCSVStorage(t)
+	ctx := context.Background()
+	in := "Product,Month,Value\ncar,Jan,1\nbike,Jan,2\ntruck,Jan,3\n"
+	if err := s.ImportCSV(ctx, "Sales", strings.NewReader(in)); err == nil {
+		t.Fatal("import succeeded with an unknown element")
+	}
+	if c, err := s.GetCell(ctx, "Sales", "car", "Jan"); err != nil || c.Value != 1 {
+		t.Errorf("car/Jan = %v, %v, want 1", c.Value, err)
+	}
+	if _, err := s.GetCell(ctx, "Sales", "truck", "Jan"); err != olap.ErrCellNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+	if n := s.cells.count("Sales"); n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+}
@@ -0,0 +1,64 @@
+package fast
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+type withoutDelayKey struct{}
+
+// WithoutDelay returns a copy of ctx that makes storage calls skip the
+// configured delay, e.g. for health checks.
+func WithoutDelay(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutDelayKey{}, true)
+}
+
+// SetDelay changes the delay every call waits before running. It's safe
+// to call while other goroutines use the storage.
+func (s *Storage) SetDelay(d time.Duration) {
+	atomic.StoreInt64(&s.delay, int64(d))
+}
+
+// Delay returns the delay every call waits before running.
+func (s *Storage) Delay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.delay))
+}
+
+// wait takes a concurrency slot, if the storage has a limit, and then
+// blocks for the configured delay. It returns the context error if ctx
+// is canceled before or while waiting. Once wait returns nil the caller
+// must call release when done.
+func (s *Storage) wait(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	d := s.Delay()
+	if d <= 0 || ctx.Value(withoutDelayKey{}) != nil {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		s.release()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// release gives back the concurrency slot taken by wait.
+func (s *Storage) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
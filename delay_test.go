@@ -0,0 +1,141 @@
+package fast
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+func TestWithoutDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	s := NewFastStorage(WithDelay(delay))
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := s.GetCube(ctx, "Sales"); err != olap.ErrCubeNotFound {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("elapsed = %v, want at least %v", elapsed, delay)
+	}
+
+	start = time.Now()
+	if _, err := s.GetCube(WithoutDelay(ctx), "Sales"); err != olap.ErrCubeNotFound {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("elapsed = %v, want less than %v", elapsed, delay)
+	}
+}
+
+func TestSetDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	s := newTestStorage()
+	ctx := context.Background()
+
+	s.SetDelay(delay)
+	if s.Delay() != delay {
+		t.Fatalf("delay = %v, want %v", s.Delay(), delay)
+	}
+	start := time.Now()
+	if _, err := s.GetCube(ctx, "Sales"); err != olap.ErrCubeNotFound {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("elapsed = %v, want at least %v", elapsed, delay)
+	}
+
+	s.SetDelay(0)
+	start = time.Now()
+	if _, err := s.GetCube(ctx, "Sales"); err != olap.ErrCubeNotFound {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("elapsed = %v, want less than %v", elapsed, delay)
+	}
+}
+
+func TestDelayDoesNotBlockWriters(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	s := NewFastStorage(WithDelay(delay))
+	ctx := context.Background()
+	cell := olap.Cell{Cube: "Sales", Elements: []string{"car"}, Value: 1}
+
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		s.GetCell(ctx, "Sales", "car")
+	}()
+	// Give the reader time to enter its delay.
+	time.Sleep(delay / 4)
+
+	start := time.Now()
+	if err := s.AddCell(WithoutDelay(ctx), cell); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay/2 {
+		t.Errorf("writer took %v while a reader was waiting", elapsed)
+	}
+	select {
+	case <-read:
+		t.Error("reader finished before its delay")
+	default:
+	}
+	<-read
+}
+
+func TestWithMaxConcurrency(t *testing.T) {
+	const (
+		delay = 20 * time.Millisecond
+		limit = 2
+		calls = 8
+	)
+	s := NewFastStorage(WithDelay(delay), WithMaxConcurrency(limit))
+	ctx := context.Background()
+
+	// With at most limit calls in their delay at once, the calls finish
+	// in waves of limit, one delay apart.
+	var (
+		mu    sync.Mutex
+		ends  []time.Duration
+		wg    sync.WaitGroup
+		start = time.Now()
+	)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetCube(ctx, "Sales"); err != olap.ErrCubeNotFound {
+				t.Error(err)
+			}
+			mu.Lock()
+			ends = append(ends, time.Since(start))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(ends, func(i, j int) bool { return ends[i] < ends[j] })
+	for i, end := range ends {
+		if min := time.Duration(i/limit+1) * delay; end < min {
+			t.Errorf("call %d finished after %v, want at least %v", i, end, min)
+		}
+	}
+
+	// A call waiting for a slot gives up when its context is done. Take
+	// every slot, as calls in flight would.
+	for i := 0; i < limit; i++ {
+		s.slots <- struct{}{}
+	}
+	wctx, cancel := context.WithTimeout(WithoutDelay(ctx), delay/4)
+	defer cancel()
+	if _, err := s.GetCube(wctx, "Sales"); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	for i := 0; i < limit; i++ {
+		s.release()
+	}
+}
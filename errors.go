@@ -0,0 +1,38 @@
+package fast
+
+import "errors"
+
+var (
+	ErrCubeMismatch          = errors.New("cell belongs to another cube")
+	ErrCellAlreadyExists     = errors.New("cell already exists")
+	ErrInvalidCoordinate     = errors.New("invalid coordinate")
+	ErrMultipleWildcards     = errors.New("only one wildcard is supported")
+	ErrDimensionAlreadySet   = errors.New("dimension already set")
+	ErrDimensionNotSet       = errors.New("dimension not set")
+	ErrIncompleteAggregation = errors.New("incomplete aggregation")
+	ErrCyclicHierarchy       = errors.New("cyclic hierarchy")
+	ErrReadOnly              = errors.New("storage is read-only")
+	ErrUnknownRecord         = errors.New("unknown log record")
+	ErrMalformedRecord       = errors.New("malformed log record")
+	ErrUnsupportedRecord     = errors.New("log record not supported by target")
+)
+
+// KeyError records an error and the dimension and element that caused it.
+type KeyError struct {
+	Op   string
+	Dim  string
+	Name string
+	Err  error
+}
+
+func (e *KeyError) Error() string {
+	key := e.Dim
+	if e.Name != "" {
+		key = e.Dim + "/" + e.Name
+	}
+	return e.Op + " " + key + ": " + e.Err.Error()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
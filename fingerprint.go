@@ -0,0 +1,90 @@
+package fast
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Fingerprint returns the SHA-256 of the storage content in hex. Storages
+// with the same cubes, dimensions, elements, hierarchies and cells have
+// the same fingerprint, whatever order they were built in.
+func (s *Storage) Fingerprint(ctx context.Context) (_ string, err error) {
+	defer s.metrics.observe("Fingerprint", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return "", err
+	}
+	defer s.release()
+	lines := s.cubes.canonical()
+	lines = append(lines, s.dimensions.canonical()...)
+	lines = append(lines, s.elements.canonical()...)
+	lines = append(lines, s.cells.canonical()...)
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		fmt.Fprintln(h, line)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// The canonical methods describe a store as one line per fact. Strings
+// are quoted so that no two contents share a line.
+
+func (s *cubes) canonical() []string {
+	s.RLock()
+	defer s.RUnlock()
+	lines := []string{}
+	for _, c := range s.cubes {
+		lines = append(lines, fmt.Sprintf("cube %q %q", c.Name, c.Dimensions))
+	}
+	return lines
+}
+
+func (s *dimensions) canonical() []string {
+	s.RLock()
+	defer s.RUnlock()
+	lines := []string{}
+	for _, d := range s.dimensions {
+		lines = append(lines, fmt.Sprintf("dimension %q", d.Name))
+	}
+	return lines
+}
+
+func (s *elements) canonical() []string {
+	s.rlockAll()
+	defer s.runlockAll()
+	lines := []string{}
+	for h, el := range s.elements {
+		lines = append(lines, fmt.Sprintf("element %q %q %v", el.Dimension, el.Name, el.Weight))
+		for key, value := range s.attributes[h] {
+			lines = append(lines, fmt.Sprintf("attribute %q %q %q %q", el.Dimension, el.Name, key, value))
+		}
+		if ordinal, ok := s.ordinals[h]; ok {
+			lines = append(lines, fmt.Sprintf("ordinal %q %q %d", el.Dimension, el.Name, ordinal))
+		}
+	}
+	for hierarchy, comps := range s.components {
+		for hp, children := range comps {
+			p := s.elements[hp]
+			for _, hc := range children {
+				c := s.elements[hc]
+				lines = append(lines, fmt.Sprintf("component %q %q %q %q %q %v",
+					hierarchy, p.Dimension, p.Name, c.Dimension, c.Name, s.weight(hp, hc)))
+			}
+		}
+	}
+	return lines
+}
+
+func (s *cells) canonical() []string {
+	s.RLock()
+	defer s.RUnlock()
+	lines := []string{}
+	for _, c := range s.cells {
+		lines = append(lines, fmt.Sprintf("cell %q %q %v", c.Cube, c.Elements, c.Value))
+	}
+	return lines
+}
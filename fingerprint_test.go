@@ -0,0 +1,57 @@
+package fast
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"north", "car"}, Value: 10},
+		{Cube: "Sales", Elements: []string{"north", "truck"}, Value: 5},
+		{Cube: "Sales", Elements: []string{"south", "car"}, Value: 100},
+	}
+	build := func(cells []olap.Cell) *Storage {
+		s := newTestStorage()
+		addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Region", "Product"}})
+		for _, c := range cells {
+			if err := s.AddCell(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+	fingerprint := func(s *Storage) string {
+		fp, err := s.Fingerprint(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+
+	s := build(cells)
+	want := fingerprint(s)
+	reversed := []olap.Cell{cells[2], cells[1], cells[0]}
+	if got := fingerprint(build(reversed)); got != want {
+		t.Errorf("fingerprint depends on insertion order: %s != %s", got, want)
+	}
+
+	if err := s.AddCell(ctx, cells[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fingerprint(s); got != want {
+		t.Errorf("re-adding a cell changed the fingerprint")
+	}
+
+	changed := cells[0]
+	changed.Value = 11
+	if err := s.AddCell(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if got := fingerprint(s); got == want {
+		t.Errorf("changing a cell kept the fingerprint")
+	}
+}
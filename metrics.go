@@ -0,0 +1,85 @@
+package fast
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OpMetric holds the counters of one storage operation.
+type OpMetric struct {
+	Count    int64
+	Errors   int64
+	Duration time.Duration
+}
+
+type opCounters struct {
+	count  int64
+	errors int64
+	nanos  int64
+}
+
+// metrics accumulates per operation counters. The lock only guards the
+// ops map; counters are updated atomically.
+type metrics struct {
+	sync.RWMutex
+	ops map[string]*opCounters
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		ops: map[string]*opCounters{},
+	}
+}
+
+// observe records a call to op that started at start and returned *err.
+// It's meant to be deferred.
+func (m *metrics) observe(op string, start time.Time, err *error) {
+	c := m.counters(op)
+	atomic.AddInt64(&c.count, 1)
+	atomic.AddInt64(&c.nanos, int64(time.Since(start)))
+	if *err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+func (m *metrics) counters(op string) *opCounters {
+	m.RLock()
+	c, ok := m.ops[op]
+	m.RUnlock()
+	if ok {
+		return c
+	}
+	m.Lock()
+	defer m.Unlock()
+	if c, ok := m.ops[op]; ok {
+		return c
+	}
+	c = &opCounters{}
+	m.ops[op] = c
+	return c
+}
+
+func (m *metrics) snapshot() map[string]OpMetric {
+	m.RLock()
+	defer m.RUnlock()
+	snap := make(map[string]OpMetric, len(m.ops))
+	for op, c := range m.ops {
+		snap[op] = OpMetric{
+			Count:    atomic.LoadInt64(&c.count),
+			Errors:   atomic.LoadInt64(&c.errors),
+			Duration: time.Duration(atomic.LoadInt64(&c.nanos)),
+		}
+	}
+	return snap
+}
+
+// Metrics returns the counters of every operation called so far, keyed
+// by method name.
+func (s *Storage) Metrics(ctx context.Context) (map[string]OpMetric, error) {
+	if err := ctx.Err(); err != nil {
+		return map[string]OpMetric{}, err
+	}
+	return s.metrics.snapshot(), nil
+}
@@ -0,0 +1,44 @@
+package fast
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	for _, name := range []string{"car", "truck", "car"} {
+		s.AddElement(ctx, olap.Element{Dimension: "Product", Name: name})
+	}
+	for i := 0; i < 4; i++ {
+		s.GetElement(ctx, "Product", "bike")
+	}
+
+	m, err := s.Metrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		op     string
+		count  int64
+		errors int64
+	}{
+		{"AddElement", 3, 1},
+		{"GetElement", 4, 4},
+	}
+	for _, tt := range tests {
+		got := m[tt.op]
+		if got.Count != tt.count || got.Errors != tt.errors {
+			t.Errorf("%s = %d calls, %d errors, want %d, %d", tt.op, got.Count, got.Errors, tt.count, tt.errors)
+		}
+		if got.Duration <= 0 {
+			t.Errorf("%s duration = %v, want > 0", tt.op, got.Duration)
+		}
+	}
+	if _, ok := m["AddCube"]; ok {
+		t.Error("AddCube has metrics but was never called")
+	}
+}
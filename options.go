@@ -0,0 +1,87 @@
+package fast
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures a storage created by NewStorage or NewFastStorage.
+type Option func(*Storage)
+
+// WithStrictCells makes AddCell return ErrCellAlreadyExists when the
+// cell is already stored instead of overwriting it.
+func WithStrictCells(strict bool) Option {
+	return func(s *Storage) {
+		s.cells.strict = strict
+	}
+}
+
+// WithStrictCoordinates makes GetCell check that every element belongs
+// to the matching cube dimension and return ErrInvalidCoordinate
+// otherwise, rather than a plain olap.ErrCellNotFound.
+func WithStrictCoordinates(strict bool) Option {
+	return func(s *Storage) {
+		s.strictCoordinates = strict
+	}
+}
+
+// WithMissingLeafPolicy sets how Rollup treats leaves without a cell.
+// The default is MissingAsZero.
+func WithMissingLeafPolicy(policy MissingLeafPolicy) Option {
+	return func(s *Storage) {
+		s.missingLeaves = policy
+	}
+}
+
+// WithAggregationCache makes Rollup, and the methods built on it,
+// remember their most recent results, up to a few thousand. A cached
+// rollup of a consolidation with the other coordinates fixed is reused
+// until a cell with those other coordinates is written or deleted, or a
+// component or weight changes in a dimension the consolidation goes
+// through. Writes to other cells of the cube keep it.
+func WithAggregationCache(enabled bool) Option {
+	return func(s *Storage) {
+		if enabled {
+			s.aggs = newAggCache(aggCacheSize)
+		} else {
+			s.aggs = nil
+		}
+	}
+}
+
+// WithWAL makes every change to the storage append a JSON record to w
+// before it is applied. ReplayWAL applies such a log to another
+// storage. Once writing to w fails, every later change returns that
+// error and isn't applied. A call that makes several changes, such as
+// ReplaceCells, keeps those applied before the failure.
+func WithWAL(w io.Writer) Option {
+	return func(s *Storage) {
+		l := newWAL(w)
+		s.cubes.wal = l
+		s.dimensions.wal = l
+		s.elements.wal = l
+		s.cells.wal = l
+	}
+}
+
+// WithDelay makes every storage call wait d before running, simulating
+// the latency of a remote backend.
+func WithDelay(d time.Duration) Option {
+	return func(s *Storage) {
+		s.delay = int64(d)
+	}
+}
+
+// WithMaxConcurrency lets at most n storage calls run at once, like a
+// backend with a limited connection pool. Other calls block before
+// their delay until a call finishes or their context is done. n <= 0
+// means no limit.
+func WithMaxConcurrency(n int) Option {
+	return func(s *Storage) {
+		if n > 0 {
+			s.slots = make(chan struct{}, n)
+		} else {
+			s.slots = nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package fast
+
+import (
+	"context"
+
+	"github.com/aclivo/olap"
+)
+
+type readOnly struct {
+	olap.Storage
+}
+
+// ReadOnly returns a storage that reads from s and fails every write
+// with ErrReadOnly.
+func ReadOnly(s olap.Storage) olap.Storage {
+	return &readOnly{Storage: s}
+}
+
+func (s *readOnly) AddCube(ctx context.Context, cube olap.Cube) error {
+	return ErrReadOnly
+}
+
+func (s *readOnly) AddDimension(ctx context.Context, dim olap.Dimension) error {
+	return ErrReadOnly
+}
+
+func (s *readOnly) AddElement(ctx context.Context, el olap.Element) error {
+	return ErrReadOnly
+}
+
+func (s *readOnly) AddComponent(ctx context.Context, tot, el olap.Element) error {
+	return ErrReadOnly
+}
+
+func (s *readOnly) AddCell(ctx context.Context, cell olap.Cell) error {
+	return ErrReadOnly
+}
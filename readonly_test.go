@@ -0,0 +1,31 @@
+package fast_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aclivo/fast"
+	"github.com/aclivo/olap"
+)
+
+func TestReadOnly(t *testing.T) {
+	s := fast.NewStorage()
+	ctx := context.Background()
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := fast.ReadOnly(s)
+	if err := ro.AddDimension(ctx, olap.Dimension{Name: "Region"}); err != fast.ErrReadOnly {
+		t.Errorf("err = %v, want %v", err, fast.ErrReadOnly)
+	}
+	if err := ro.AddElement(ctx, olap.Element{Dimension: "Product", Name: "car"}); err != fast.ErrReadOnly {
+		t.Errorf("err = %v, want %v", err, fast.ErrReadOnly)
+	}
+	if _, err := ro.GetDimension(ctx, "Product"); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := s.GetDimension(ctx, "Region"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
@@ -0,0 +1,168 @@
+package fast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+// cubeSnapshot is everything SnapshotCube writes about a cube.
+type cubeSnapshot struct {
+	Cube       olap.Cube           `json:"cube"`
+	Dimensions []olap.Dimension    `json:"dimensions"`
+	Elements   []snapshotElement   `json:"elements"`
+	Components []snapshotComponent `json:"components"`
+	Cells      []olap.Cell         `json:"cells"`
+}
+
+type snapshotElement struct {
+	Element    olap.Element      `json:"element"`
+	Ordinal    *int              `json:"ordinal,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// snapshotComponent is a component with its weight. Weights only apply
+// to the default hierarchy and are 1 in the others.
+type snapshotComponent struct {
+	Hierarchy string       `json:"hierarchy"`
+	Parent    olap.Element `json:"parent"`
+	Child     olap.Element `json:"child"`
+	Weight    float64      `json:"weight"`
+}
+
+// SnapshotCube writes cube to w as JSON together with its dimensions,
+// their elements with ordinals and attributes, their weighted components
+// and the cube's cells. LoadCube reads it back.
+func (s *Storage) SnapshotCube(ctx context.Context, cube string, w io.Writer) (err error) {
+	defer s.metrics.observe("SnapshotCube", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return err
+	}
+	snap := cubeSnapshot{
+		Cube:       c,
+		Dimensions: []olap.Dimension{},
+		Elements:   []snapshotElement{},
+		Components: []snapshotComponent{},
+		Cells:      []olap.Cell{},
+	}
+	for _, name := range c.Dimensions {
+		dim, err := s.dimensions.getDimension(name)
+		if err != nil {
+			return err
+		}
+		snap.Dimensions = append(snap.Dimensions, dim)
+		snap.Elements = append(snap.Elements, s.elements.snapshot(name)...)
+		snap.Components = append(snap.Components, s.elements.edges(name)...)
+	}
+	s.cells.rangeCells(cube, func(cell olap.Cell) bool {
+		snap.Cells = append(snap.Cells, cell)
+		return true
+	})
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// LoadCube adds a cube written by SnapshotCube to the storage. Existing
+// dimensions, elements and components are kept, so other cubes sharing
+// them aren't affected, but the ordinals, attributes and weights in the
+// snapshot are set on them. The cube and its cells are overwritten:
+// cells of the cube missing from the snapshot are deleted.
+//
+// The snapshot is checked before anything is changed, so a snapshot
+// that refers to missing dimensions or elements changes nothing. The
+// load itself isn't atomic, though: if it fails partway, for example on
+// a log write error, the changes made before the failure are kept.
+func (s *Storage) LoadCube(ctx context.Context, r io.Reader) (err error) {
+	defer s.metrics.observe("LoadCube", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	var snap cubeSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return err
+	}
+	if err := s.checkSnapshot(snap); err != nil {
+		return err
+	}
+	for _, dim := range snap.Dimensions {
+		if err := s.dimensions.addDimension(dim); err != nil && !errors.Is(err, olap.ErrDimensionAlreadyExists) {
+			return err
+		}
+	}
+	for _, el := range snap.Elements {
+		e := el.Element
+		if err := s.elements.addElement(e); err != nil && !errors.Is(err, olap.ErrElementAlreadyExists) {
+			return err
+		}
+		if el.Ordinal != nil {
+			if err := s.elements.setOrdinal(e.Dimension, e.Name, *el.Ordinal); err != nil {
+				return err
+			}
+		}
+		for key, value := range el.Attributes {
+			if err := s.elements.setAttribute(e.Dimension, e.Name, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range snap.Components {
+		if err := s.elements.addComponentIn(c.Hierarchy, c.Parent, c.Child); err != nil && !errors.Is(err, olap.ErrComponentAlreadyExists) {
+			return err
+		}
+		if c.Hierarchy == defaultHierarchy {
+			err := s.elements.setWeight(c.Parent.Dimension, c.Parent.Name, c.Child.Dimension, c.Child.Name, c.Weight)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.cubes.addCube(snap.Cube); err != nil {
+		return err
+	}
+	return s.cells.replaceCells(snap.Cube.Name, snap.Cells)
+}
+
+// checkSnapshot reports whether LoadCube can apply snap: the cube's
+// dimensions and the elements of its components must be in the snapshot
+// or the storage, and its cells must belong to the cube.
+func (s *Storage) checkSnapshot(snap cubeSnapshot) error {
+	dims := map[string]bool{}
+	for _, dim := range snap.Dimensions {
+		dims[dim.Name] = true
+	}
+	found := s.dimensions.exist(snap.Cube.Dimensions)
+	for _, dim := range snap.Cube.Dimensions {
+		if !dims[dim] && !found[dim] {
+			return &KeyError{Op: "load cube", Dim: dim, Err: olap.ErrDimensionNotFound}
+		}
+	}
+	els := map[string]bool{}
+	for _, el := range snap.Elements {
+		els[hash(el.Element.Dimension, el.Element.Name)] = true
+	}
+	for _, c := range snap.Components {
+		for _, el := range []olap.Element{c.Parent, c.Child} {
+			if els[hash(el.Dimension, el.Name)] {
+				continue
+			}
+			if _, err := s.elements.getElement(el.Dimension, el.Name); err != nil {
+				return &KeyError{Op: "load cube", Dim: el.Dimension, Name: el.Name, Err: err}
+			}
+		}
+	}
+	for _, cell := range snap.Cells {
+		if cell.Cube != snap.Cube.Name {
+			return ErrCubeMismatch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func TestSnapshotCube(t *testing.T) {
+	src := newTestStorage()
+	ctx := context.Background()
+	els := []olap.Element{
+		{Dimension: "Product", Name: "vehicles"},
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Product", Name: "truck"},
+		{Dimension: "Region", Name: "north"},
+	}
+	for _, el := range els {
+		if err := src.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, el := range els[1:3] {
+		if err := src.AddComponent(ctx, els[0], el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addCube(t, src, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	addCube(t, src, olap.Cube{Name: "Costs", Dimensions: []string{"Region"}})
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car"}, Value: 1},
+		{Cube: "Sales", Elements: []string{"truck"}, Value: 2},
+		{Cube: "Costs", Elements: []string{"north"}, Value: 3},
+	}
+	for _, c := range cells {
+		if err := src.AddCell(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := src.SetComponentWeight(ctx, "Product", "vehicles", "Product", "truck", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetElementOrdinal(ctx, "Product", "truck", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetElementAttribute(ctx, "Product", "car", "color", "red"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.SnapshotCube(ctx, "Sales", &buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := NewFastStorage(WithStrictCells(true))
+	if err := dst.LoadCube(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := dst.Rollup(ctx, "Sales", "Product", "vehicles"); err != nil || got != -1 {
+		t.Errorf("Rollup = %v, %v, want -1", got, err)
+	}
+	if els, err := dst.ListElements(ctx, "Product"); err != nil || !equal(names(els), []string{"truck", "car", "vehicles"}) {
+		t.Errorf("elements = %v, %v, want [truck car vehicles]", names(els), err)
+	}
+	if attrs, err := dst.GetElementAttributes(ctx, "Product", "car"); err != nil || attrs["color"] != "red" {
+		t.Errorf("attributes = %v, %v", attrs, err)
+	}
+	if _, err := dst.GetCube(ctx, "Costs"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+	if _, err := dst.GetDimension(ctx, "Region"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+
+	// Loading again merges into the existing dimensions and elements and
+	// replaces the cells.
+	if err := src.DeleteCell(ctx, "Sales", "car"); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := src.SnapshotCube(ctx, "Sales", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.LoadCube(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := dst.cells.count("Sales"); n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+	if got, err := dst.Rollup(ctx, "Sales", "Product", "vehicles"); err != nil || got != -2 {
+		t.Errorf("Rollup = %v, %v, want -2", got, err)
+	}
+}
+
+func TestSnapshotCubePrefixDimension(t *testing.T) {
+	src := newTestStorage()
+	ctx := context.Background()
+	addCube(t, src, olap.Cube{Name: "Sales", Dimensions: []string{"A"}})
+	addDimensions(t, src, "A#B")
+	els := []olap.Element{
+		{Dimension: "A", Name: "a"},
+		{Dimension: "A#B", Name: "p"},
+		{Dimension: "A#B", Name: "c"},
+	}
+	for _, el := range els {
+		if err := src.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.AddComponent(ctx, els[1], els[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.SnapshotCube(ctx, "Sales", &buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := newTestStorage()
+	if err := dst.LoadCube(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.GetDimension(ctx, "A#B"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
+
+func TestLoadCubeInvalid(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		snap string
+		want error
+	}{
+		{
+			`{"cube":{"Name":"Sales","Dimensions":["Product","Region"]},"dimensions":[{"Name":"Product"}]}`,
+			olap.ErrDimensionNotFound,
+		},
+		{
+			`{"cube":{"Name":"Sales","Dimensions":["Product"]},"dimensions":[{"Name":"Product"}],` +
+				`"elements":[{"element":{"Name":"car","Dimension":"Product"}}],` +
+				`"components":[{"hierarchy":"default","parent":{"Name":"vehicles","Dimension":"Product"},"child":{"Name":"car","Dimension":"Product"},"weight":1}]}`,
+			olap.ErrElementNotFound,
+		},
+		{
+			`{"cube":{"Name":"Sales","Dimensions":["Product"]},"dimensions":[{"Name":"Product"}],` +
+				`"cells":[{"Cube":"Costs","Elements":["car"],"Value":1}]}`,
+			ErrCubeMismatch,
+		},
+	}
+	for _, tt := range tests {
+		s := newTestStorage()
+		if err := s.LoadCube(ctx, strings.NewReader(tt.snap)); !errors.Is(err, tt.want) {
+			t.Errorf("err = %v, want %v", err, tt.want)
+		}
+		if empty, err := s.IsEmpty(ctx); err != nil || !empty {
+			t.Errorf("storage changed by a failed load")
+		}
+	}
+}
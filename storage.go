@@ -1,111 +1,666 @@
 package fast
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"io"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aclivo/olap"
 )
 
-type storage struct {
+// Storage is an in-memory olap.Storage. Besides the interface methods it
+// offers listing, aggregation, snapshot and maintenance methods; use
+// NewFastStorage to get at them without a type assertion.
+type Storage struct {
+	// delay is accessed atomically, so it must stay the first field to be
+	// 64-bit aligned on 32-bit platforms.
+	delay int64 // nanoseconds
+
 	cubes      *cubes
 	dimensions *dimensions
 	elements   *elements
 	cells      *cells
+	metrics    *metrics
+	aggs       *aggCache
+	// slots bounds the number of calls in flight; nil means no limit.
+	slots chan struct{}
+
+	strictCoordinates bool
+	missingLeaves     MissingLeafPolicy
 }
 
+var _ olap.Storage = (*Storage)(nil)
+
 // NewStorage creates a new fast storage.
-func NewStorage() olap.Storage {
-	return &storage{
+func NewStorage(opts ...Option) olap.Storage {
+	return NewFastStorage(opts...)
+}
+
+// NewFastStorage creates a new fast storage and returns the concrete type.
+func NewFastStorage(opts ...Option) *Storage {
+	s := &Storage{
 		cubes:      newCubes(),
 		dimensions: newDimensions(),
 		elements:   newElements(),
 		cells:      newCells(),
+		metrics:    newMetrics(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// IsEmpty reports whether the storage holds no cubes, dimensions,
+// elements or cells.
+func (s *Storage) IsEmpty(ctx context.Context) (_ bool, err error) {
+	defer s.metrics.observe("IsEmpty", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return false, err
 	}
+	defer s.release()
+	empty := s.cubes.len() == 0 &&
+		s.dimensions.len() == 0 &&
+		s.elements.len() == 0 &&
+		s.cells.len() == 0
+	return empty, nil
 }
 
-func (s *storage) AddCube(ctx context.Context, cube olap.Cube) error {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return ctx.Err()
+func (s *Storage) AddCube(ctx context.Context, cube olap.Cube) (err error) {
+	defer s.metrics.observe("AddCube", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	found := s.dimensions.exist(cube.Dimensions)
+	for _, dim := range cube.Dimensions {
+		if !found[dim] {
+			return &KeyError{Op: "add cube", Dim: dim, Err: olap.ErrDimensionNotFound}
+		}
 	}
 	return s.cubes.addCube(cube)
 }
 
-func (s *storage) GetCube(ctx context.Context, name string) (olap.Cube, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return olap.Cube{}, ctx.Err()
+// GetCube returns the cube called name, or olap.ErrCubeNotFound if there
+// is none.
+func (s *Storage) GetCube(ctx context.Context, name string) (_ olap.Cube, err error) {
+	defer s.metrics.observe("GetCube", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Cube{}, err
 	}
+	defer s.release()
 	return s.cubes.getCube(name)
 }
 
-func (s *storage) AddDimension(ctx context.Context, dim olap.Dimension) error {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return ctx.Err()
+// GetCubeDimensions returns a copy of the dimension names of cube.
+func (s *Storage) GetCubeDimensions(ctx context.Context, cube string) (_ []string, err error) {
+	defer s.metrics.observe("GetCubeDimensions", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []string{}, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return []string{}, err
+	}
+	return c.Dimensions, nil
+}
+
+// CubesExist reports, for each name, whether it's a cube.
+func (s *Storage) CubesExist(ctx context.Context, names []string) (_ map[string]bool, err error) {
+	defer s.metrics.observe("CubesExist", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return map[string]bool{}, err
+	}
+	defer s.release()
+	return s.cubes.exist(names), nil
+}
+
+// ListCubes returns every cube, sorted by name.
+func (s *Storage) ListCubes(ctx context.Context) (_ []olap.Cube, err error) {
+	defer s.metrics.observe("ListCubes", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Cube{}, err
+	}
+	defer s.release()
+	return s.cubes.list(), nil
+}
+
+// CubeDensity returns the ratio of stored cells to the number of cells
+// the cube could hold, that is, the product of its dimension sizes.
+func (s *Storage) CubeDensity(ctx context.Context, cube string) (_ float64, err error) {
+	defer s.metrics.observe("CubeDensity", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return 0, err
+	}
+	sizes := s.elements.sizes()
+	max := 1.0
+	for _, dim := range c.Dimensions {
+		if sizes[dim] == 0 {
+			return 0, nil
+		}
+		max *= float64(sizes[dim])
+	}
+	return float64(s.cells.count(cube)) / max, nil
+}
+
+func (s *Storage) AddDimension(ctx context.Context, dim olap.Dimension) (err error) {
+	defer s.metrics.observe("AddDimension", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
 	}
+	defer s.release()
 	return s.dimensions.addDimension(dim)
 }
 
-func (s *storage) GetDimension(ctx context.Context, name string) (olap.Dimension, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return olap.Dimension{}, ctx.Err()
+func (s *Storage) GetDimension(ctx context.Context, name string) (_ olap.Dimension, err error) {
+	defer s.metrics.observe("GetDimension", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Dimension{}, err
 	}
+	defer s.release()
 	return s.dimensions.getDimension(name)
 }
 
-func (s *storage) AddElement(ctx context.Context, el olap.Element) error {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return ctx.Err()
+// DimensionSizes returns the number of elements of every dimension.
+func (s *Storage) DimensionSizes(ctx context.Context) (_ map[string]int, err error) {
+	defer s.metrics.observe("DimensionSizes", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return map[string]int{}, err
 	}
+	defer s.release()
+	sizes := map[string]int{}
+	for _, name := range s.dimensions.names() {
+		sizes[name] = 0
+	}
+	for dim, n := range s.elements.sizes() {
+		if _, ok := sizes[dim]; ok {
+			sizes[dim] = n
+		}
+	}
+	return sizes, nil
+}
+
+// DimensionsExist reports, for each name, whether it's a dimension.
+func (s *Storage) DimensionsExist(ctx context.Context, names []string) (_ map[string]bool, err error) {
+	defer s.metrics.observe("DimensionsExist", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return map[string]bool{}, err
+	}
+	defer s.release()
+	return s.dimensions.exist(names), nil
+}
+
+// ListDimensions returns every dimension, sorted by name.
+func (s *Storage) ListDimensions(ctx context.Context) (_ []olap.Dimension, err error) {
+	defer s.metrics.observe("ListDimensions", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Dimension{}, err
+	}
+	defer s.release()
+	return s.dimensions.list(), nil
+}
+
+func (s *Storage) AddElement(ctx context.Context, el olap.Element) (err error) {
+	defer s.metrics.observe("AddElement", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
 	return s.elements.addElement(el)
 }
 
-func (s *storage) GetElement(ctx context.Context, dim, el string) (olap.Element, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return olap.Element{}, ctx.Err()
+func (s *Storage) GetElement(ctx context.Context, dim, el string) (_ olap.Element, err error) {
+	defer s.metrics.observe("GetElement", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Element{}, err
 	}
+	defer s.release()
 	return s.elements.getElement(dim, el)
 }
 
-func (s *storage) AddComponent(ctx context.Context, tot, el olap.Element) error {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return ctx.Err()
+// SetElementAttribute sets the attribute key of an element to value.
+func (s *Storage) SetElementAttribute(ctx context.Context, dim, element, key, value string) (err error) {
+	defer s.metrics.observe("SetElementAttribute", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.elements.setAttribute(dim, element, key, value)
+}
+
+// GetElementAttributes returns a copy of the attributes of an element.
+func (s *Storage) GetElementAttributes(ctx context.Context, dim, element string) (_ map[string]string, err error) {
+	defer s.metrics.observe("GetElementAttributes", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return map[string]string{}, err
+	}
+	defer s.release()
+	return s.elements.getAttributes(dim, element)
+}
+
+// SetElementOrdinal sets the position of an element in listings.
+// Elements with an ordinal sort by it, before elements without one,
+// which sort by name.
+func (s *Storage) SetElementOrdinal(ctx context.Context, dim, element string, ordinal int) (err error) {
+	defer s.metrics.observe("SetElementOrdinal", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.elements.setOrdinal(dim, element, ordinal)
+}
+
+// ListElements returns the elements of dim in ordinal order.
+func (s *Storage) ListElements(ctx context.Context, dim string) (_ []olap.Element, err error) {
+	defer s.metrics.observe("ListElements", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Element{}, err
+	}
+	defer s.release()
+	return s.elements.list(dim), nil
+}
+
+// ElementsExist reports, for each name, whether it's an element of dim.
+func (s *Storage) ElementsExist(ctx context.Context, dim string, names []string) (_ map[string]bool, err error) {
+	defer s.metrics.observe("ElementsExist", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return map[string]bool{}, err
+	}
+	defer s.release()
+	if _, err := s.dimensions.getDimension(dim); err != nil {
+		return map[string]bool{}, err
+	}
+	return s.elements.exist(dim, names), nil
+}
+
+func (s *Storage) AddComponent(ctx context.Context, tot, el olap.Element) (err error) {
+	defer s.metrics.observe("AddComponent", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
 	}
+	defer s.release()
 	return s.elements.addComponent(tot, el)
 }
 
-func (s *storage) GetComponent(ctx context.Context, dim, name string) (olap.Element, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return olap.Element{}, ctx.Err()
+// AddComponentIn adds el as a component of tot in the named hierarchy.
+func (s *Storage) AddComponentIn(ctx context.Context, hierarchy string, tot, el olap.Element) (err error) {
+	defer s.metrics.observe("AddComponentIn", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.elements.addComponentIn(hierarchy, tot, el)
+}
+
+func (s *Storage) GetComponent(ctx context.Context, dim, name string) (_ olap.Element, err error) {
+	defer s.metrics.observe("GetComponent", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Element{}, err
 	}
+	defer s.release()
 	return s.elements.getComponent(dim, name)
 }
 
-func (s *storage) Children(ctx context.Context, dim, name string) ([]olap.Element, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return []olap.Element{}, ctx.Err()
+func (s *Storage) Children(ctx context.Context, dim, name string) (_ []olap.Element, err error) {
+	defer s.metrics.observe("Children", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Element{}, err
+	}
+	defer s.release()
+	if _, err := s.dimensions.getDimension(dim); err != nil {
+		return []olap.Element{}, err
 	}
 	return s.elements.children(dim, name)
 }
 
-func (s *storage) AddCell(ctx context.Context, cell olap.Cell) error {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return ctx.Err()
+// GetComponentWeight returns the weight of child in the parent
+// consolidation of the default hierarchy. Weights default to 1.
+func (s *Storage) GetComponentWeight(ctx context.Context, parentDim, parent, childDim, child string) (_ float64, err error) {
+	defer s.metrics.observe("GetComponentWeight", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	return s.elements.getWeight(parentDim, parent, childDim, child)
+}
+
+// DetachElement removes an element from the components of all its
+// parents in every hierarchy, making it a root. The element and its own
+// components are kept.
+func (s *Storage) DetachElement(ctx context.Context, dim, name string) (err error) {
+	defer s.metrics.observe("DetachElement", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.elements.detach(dim, name)
+}
+
+// SetComponentWeight sets the weight of child in the parent
+// consolidation of the default hierarchy.
+func (s *Storage) SetComponentWeight(ctx context.Context, parentDim, parent, childDim, child string, weight float64) (err error) {
+	defer s.metrics.observe("SetComponentWeight", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.elements.setWeight(parentDim, parent, childDim, child, weight)
+}
+
+// ChildrenIn returns the components of an element in the named hierarchy.
+func (s *Storage) ChildrenIn(ctx context.Context, hierarchy, dim, name string) (_ []olap.Element, err error) {
+	defer s.metrics.observe("ChildrenIn", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Element{}, err
+	}
+	defer s.release()
+	if _, err := s.dimensions.getDimension(dim); err != nil {
+		return []olap.Element{}, err
+	}
+	return s.elements.childrenIn(hierarchy, dim, name)
+}
+
+// IsFlat reports whether no element of dim has components in any
+// hierarchy.
+func (s *Storage) IsFlat(ctx context.Context, dim string) (_ bool, err error) {
+	defer s.metrics.observe("IsFlat", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return false, err
+	}
+	defer s.release()
+	if _, err := s.dimensions.getDimension(dim); err != nil {
+		return false, err
+	}
+	return !s.elements.hasComponents(dim), nil
+}
+
+// ElementDepth returns the number of edges on the shortest path from a
+// root of the default hierarchy down to an element. Roots have depth 0.
+func (s *Storage) ElementDepth(ctx context.Context, dim, name string) (_ int, err error) {
+	defer s.metrics.observe("ElementDepth", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	return s.elements.depth(dim, name)
+}
+
+// SubtreeSize returns the number of distinct elements under root in the
+// default hierarchy, counting root itself.
+func (s *Storage) SubtreeSize(ctx context.Context, dim, root string) (_ int, err error) {
+	defer s.metrics.observe("SubtreeSize", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	seen := map[string]bool{}
+	cyclic := false
+	err = s.elements.walk(dim, root, func(el olap.Element, _ int, cycle bool) {
+		seen[hash(el.Dimension, el.Name)] = true
+		cyclic = cyclic || cycle
+	})
+	if err != nil {
+		return 0, err
+	}
+	if cyclic {
+		return 0, ErrCyclicHierarchy
+	}
+	return len(seen), nil
+}
+
+// DumpHierarchy writes the subtree under root to w as an indented tree,
+// one element per line and two spaces per level. An element that closes
+// a cycle is marked with "(cycle)" and not expanded further.
+func (s *Storage) DumpHierarchy(ctx context.Context, dim, root string, w io.Writer) (err error) {
+	defer s.metrics.observe("DumpHierarchy", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	var buf bytes.Buffer
+	err = s.elements.walk(dim, root, func(el olap.Element, depth int, cycle bool) {
+		buf.WriteString(strings.Repeat("  ", depth))
+		buf.WriteString(el.Name)
+		if cycle {
+			buf.WriteString(" (cycle)")
+		}
+		buf.WriteString("\n")
+	})
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (s *Storage) AddCell(ctx context.Context, cell olap.Cell) (err error) {
+	defer s.metrics.observe("AddCell", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
 	}
+	defer s.release()
 	return s.cells.addCell(cell)
 }
 
-func (s *storage) GetCell(ctx context.Context, cube string, elements ...string) (olap.Cell, error) {
-	if errors.Is(ctx.Err(), context.Canceled) {
-		return olap.Cell{}, ctx.Err()
+func (s *Storage) GetCell(ctx context.Context, cube string, elements ...string) (_ olap.Cell, err error) {
+	defer s.metrics.observe("GetCell", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Cell{}, err
+	}
+	defer s.release()
+	if _, err := s.cubes.getCube(cube); err != nil {
+		return olap.Cell{}, err
+	}
+	if s.strictCoordinates {
+		if err := s.checkCoordinate(cube, elements); err != nil {
+			return olap.Cell{}, err
+		}
 	}
 	return s.cells.getCell(cube, elements...)
 }
 
+// Wildcard matches every element of a dimension in GetCellsWildcard.
+const Wildcard = "*"
+
+// GetCellsWildcard returns the stored cells matching coords, where one
+// entry may be Wildcard to match every element of its dimension. Missing
+// cells are left out.
+func (s *Storage) GetCellsWildcard(ctx context.Context, cube string, coords []string) (_ []olap.Cell, err error) {
+	defer s.metrics.observe("GetCellsWildcard", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return []olap.Cell{}, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return []olap.Cell{}, err
+	}
+	if len(coords) != len(c.Dimensions) {
+		return []olap.Cell{}, ErrInvalidCoordinate
+	}
+	pos := -1
+	for i, el := range coords {
+		if el != Wildcard {
+			continue
+		}
+		if pos >= 0 {
+			return []olap.Cell{}, ErrMultipleWildcards
+		}
+		pos = i
+	}
+	if pos < 0 {
+		cell, err := s.cells.getCell(cube, coords...)
+		if err == olap.ErrCellNotFound {
+			return []olap.Cell{}, nil
+		}
+		return []olap.Cell{cell}, err
+	}
+	others := append(append([]string{}, coords[:pos]...), coords[pos+1:]...)
+	cells := []olap.Cell{}
+	for _, el := range s.elements.list(c.Dimensions[pos]) {
+		cell, err := s.cells.getCell(cube, coordinate(others, pos, el.Name)...)
+		if err == olap.ErrCellNotFound {
+			continue
+		}
+		if err != nil {
+			return []olap.Cell{}, err
+		}
+		cells = append(cells, cell)
+	}
+	return cells, nil
+}
+
+// TryGetCell is like GetCell but reports a missing cell with a false
+// flag instead of olap.ErrCellNotFound. The error is only set when ctx
+// is done.
+func (s *Storage) TryGetCell(ctx context.Context, cube string, elements ...string) (_ olap.Cell, _ bool, err error) {
+	defer s.metrics.observe("TryGetCell", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return olap.Cell{}, false, err
+	}
+	defer s.release()
+	c, ok := s.cells.lookup(cube, elements...)
+	return c, ok, nil
+}
+
+// checkCoordinate verifies that every element exists in the cube
+// dimension at its position.
+func (s *Storage) checkCoordinate(cube string, elements []string) error {
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return err
+	}
+	if len(elements) != len(c.Dimensions) {
+		return ErrInvalidCoordinate
+	}
+	for i, dim := range c.Dimensions {
+		if _, err := s.elements.getElement(dim, elements[i]); err != nil {
+			return &KeyError{Op: "get cell", Dim: dim, Name: elements[i], Err: ErrInvalidCoordinate}
+		}
+	}
+	return nil
+}
+
+// ReplaceCells atomically replaces every cell of cube with cells.
+func (s *Storage) ReplaceCells(ctx context.Context, cube string, cells []olap.Cell) (err error) {
+	defer s.metrics.observe("ReplaceCells", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.cells.replaceCells(cube, cells)
+}
+
+// DeleteCell deletes the cell of cube at elements.
+func (s *Storage) DeleteCell(ctx context.Context, cube string, elements ...string) (err error) {
+	defer s.metrics.observe("DeleteCell", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.cells.deleteCell(cube, elements...)
+}
+
+// ClearCube deletes every cell of cube, keeping the cube, its
+// dimensions and their elements.
+func (s *Storage) ClearCube(ctx context.Context, cube string) (err error) {
+	defer s.metrics.observe("ClearCube", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	if _, err := s.cubes.getCube(cube); err != nil {
+		return err
+	}
+	return s.cells.clear(cube)
+}
+
+// DeleteCellsByElement deletes every cell of cube whose coordinate in
+// dim is element and returns how many were deleted.
+func (s *Storage) DeleteCellsByElement(ctx context.Context, cube, dim, element string) (_ int, err error) {
+	defer s.metrics.observe("DeleteCellsByElement", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return 0, err
+	}
+	pos := indexOf(c.Dimensions, dim)
+	if pos < 0 {
+		return 0, olap.ErrDimensionNotFound
+	}
+	return s.cells.deleteByElement(cube, pos, element)
+}
+
+// MergePolicy decides what RemapElement does when a remapped cell lands
+// on a cell that's already stored.
+type MergePolicy int
+
+const (
+	// MergeOverwrite replaces the stored cell with the remapped one.
+	MergeOverwrite MergePolicy = iota
+	// MergeSum stores the sum of both values.
+	MergeSum
+	// MergeError fails with ErrCellAlreadyExists and changes nothing.
+	MergeError
+)
+
+// RemapElement moves every cell of cube whose coordinate in dim is from
+// to the same coordinate with to instead. All cells move under a single
+// lock, so readers see either the old or the new state.
+func (s *Storage) RemapElement(ctx context.Context, cube, dim, from, to string, merge MergePolicy) (err error) {
+	defer s.metrics.observe("RemapElement", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	c, err := s.cubes.getCube(cube)
+	if err != nil {
+		return err
+	}
+	pos := indexOf(c.Dimensions, dim)
+	if pos < 0 {
+		return olap.ErrDimensionNotFound
+	}
+	for _, el := range []string{from, to} {
+		if _, err := s.elements.getElement(dim, el); err != nil {
+			return &KeyError{Op: "remap element", Dim: dim, Name: el, Err: err}
+		}
+	}
+	if from == to {
+		return nil
+	}
+	return s.cells.remap(cube, pos, from, to, merge)
+}
+
+// RangeCells calls fn for every cell of cube until fn returns false.
+// The callback runs while the cells read lock is held, so it must not
+// call back into the storage or it will deadlock.
+func (s *Storage) RangeCells(ctx context.Context, cube string, fn func(olap.Cell) bool) (err error) {
+	defer s.metrics.observe("RangeCells", time.Now(), &err)
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.cells.rangeCells(cube, fn)
+}
+
 type cubes struct {
 	sync.RWMutex
 	cubes map[string]olap.Cube
+	wal   *wal
 }
 
 func newCubes() *cubes {
@@ -117,19 +672,65 @@ func newCubes() *cubes {
 func (s *cubes) addCube(cube olap.Cube) error {
 	s.Lock()
 	defer s.Unlock()
-	s.cubes[cube.Name] = cube
+	if err := s.wal.log(walRecord{Op: "AddCube", Cube: &cube}); err != nil {
+		return err
+	}
+	s.cubes[cube.Name] = copyCube(cube)
 	return nil
 }
 
 func (s *cubes) getCube(name string) (olap.Cube, error) {
 	s.RLock()
 	defer s.RUnlock()
-	return s.cubes[name], nil
+	c, ok := s.cubes[name]
+	if !ok {
+		return olap.Cube{}, olap.ErrCubeNotFound
+	}
+	return copyCube(c), nil
+}
+
+func (s *cubes) exist(names []string) map[string]bool {
+	found := make(map[string]bool, len(names))
+	s.RLock()
+	defer s.RUnlock()
+	for _, name := range names {
+		_, found[name] = s.cubes[name]
+	}
+	return found
+}
+
+func (s *cubes) len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.cubes)
+}
+
+func (s *cubes) list() []olap.Cube {
+	s.RLock()
+	defer s.RUnlock()
+	cubes := make([]olap.Cube, 0, len(s.cubes))
+	for _, c := range s.cubes {
+		cubes = append(cubes, copyCube(c))
+	}
+	sort.Slice(cubes, func(i, j int) bool {
+		return cubes[i].Name < cubes[j].Name
+	})
+	return cubes
+}
+
+// copyCube returns a cube that shares no memory with c, so callers can't
+// mutate the stored cube through its dimension list.
+func copyCube(c olap.Cube) olap.Cube {
+	if c.Dimensions != nil {
+		c.Dimensions = append([]string{}, c.Dimensions...)
+	}
+	return c
 }
 
 type dimensions struct {
 	sync.RWMutex
 	dimensions map[string]olap.Dimension
+	wal        *wal
 }
 
 func newDimensions() *dimensions {
@@ -142,7 +743,10 @@ func (s *dimensions) addDimension(dim olap.Dimension) error {
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.dimensions[dim.Name]; ok {
-		return olap.ErrDimensionAlreadyExists
+		return &KeyError{Op: "add dimension", Dim: dim.Name, Err: olap.ErrDimensionAlreadyExists}
+	}
+	if err := s.wal.log(walRecord{Op: "AddDimension", Dimension: &dim}); err != nil {
+		return err
 	}
 	s.dimensions[dim.Name] = dim
 	return nil
@@ -158,25 +762,111 @@ func (s *dimensions) getDimension(name string) (olap.Dimension, error) {
 	return d, nil
 }
 
+// defaultHierarchy is the hierarchy used by AddComponent and Children.
+const defaultHierarchy = "default"
+
+func (s *dimensions) exist(names []string) map[string]bool {
+	found := make(map[string]bool, len(names))
+	s.RLock()
+	defer s.RUnlock()
+	for _, name := range names {
+		_, found[name] = s.dimensions[name]
+	}
+	return found
+}
+
+func (s *dimensions) len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.dimensions)
+}
+
+func (s *dimensions) list() []olap.Dimension {
+	s.RLock()
+	defer s.RUnlock()
+	dims := make([]olap.Dimension, 0, len(s.dimensions))
+	for _, d := range s.dimensions {
+		dims = append(dims, d)
+	}
+	sort.Slice(dims, func(i, j int) bool {
+		return dims[i].Name < dims[j].Name
+	})
+	return dims
+}
+
+func (s *dimensions) names() []string {
+	s.RLock()
+	defer s.RUnlock()
+	names := make([]string, 0, len(s.dimensions))
+	for name := range s.dimensions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// elements holds the elements and their hierarchies behind two locks, so
+// adding elements and adding components don't contend. The embedded
+// lock guards elements, attributes and ordinals; hmu guards components,
+// parents and weights. Code that reads both always takes the embedded
+// lock first. Hierarchy writers only check that elements exist, under a
+// read lock they release before taking hmu: elements are never removed,
+// so the check stays true.
 type elements struct {
 	sync.RWMutex
 	elements   map[string]olap.Element
-	components map[string][]string
+	attributes map[string]map[string]string
+	ordinals   map[string]int
+	wal        *wal
+
+	hmu sync.RWMutex
+	// components maps a hierarchy to the component lists of its parents.
+	components map[string]map[string][]string
+	// parents is the reverse of components.
+	parents map[string]map[string][]string
+	// weights holds the component weights set explicitly, keyed by the
+	// hash of the parent and child hashes. Other weights are 1.
+	weights map[string]float64
+	// dims maps the hash of every element in a hierarchy to its
+	// dimension, so hierarchy writers don't need the embedded lock.
+	dims map[string]string
+	// versions counts the changes to the components and weights of the
+	// elements of each dimension. The aggregation cache uses it to spot
+	// stale rollups.
+	versions map[string]uint64
 }
 
 func newElements() *elements {
 	return &elements{
 		elements:   map[string]olap.Element{},
-		components: map[string][]string{},
+		components: map[string]map[string][]string{},
+		parents:    map[string]map[string][]string{},
+		attributes: map[string]map[string]string{},
+		ordinals:   map[string]int{},
+		weights:    map[string]float64{},
+		dims:       map[string]string{},
+		versions:   map[string]uint64{},
 	}
 }
 
+func (s *elements) rlockAll() {
+	s.RLock()
+	s.hmu.RLock()
+}
+
+func (s *elements) runlockAll() {
+	s.hmu.RUnlock()
+	s.RUnlock()
+}
+
 func (s *elements) addElement(el olap.Element) error {
 	h := hash(el.Dimension, el.Name)
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.elements[h]; ok {
-		return olap.ErrElementAlreadyExists
+		return &KeyError{Op: "add element", Dim: el.Dimension, Name: el.Name, Err: olap.ErrElementAlreadyExists}
+	}
+	if err := s.wal.log(walRecord{Op: "AddElement", Element: &el}); err != nil {
+		return err
 	}
 	s.elements[h] = el
 	return nil
@@ -193,59 +883,606 @@ func (s *elements) getElement(dim, el string) (olap.Element, error) {
 	return e, nil
 }
 
+func (s *elements) setAttribute(dim, el, key, value string) error {
+	h := hash(dim, el)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.elements[h]; !ok {
+		return olap.ErrElementNotFound
+	}
+	err := s.wal.log(walRecord{
+		Op:      "SetElementAttribute",
+		Element: &olap.Element{Dimension: dim, Name: el},
+		Key:     key,
+		Value:   value,
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := s.attributes[h]; !ok {
+		s.attributes[h] = map[string]string{}
+	}
+	s.attributes[h][key] = value
+	return nil
+}
+
+func (s *elements) getAttributes(dim, el string) (map[string]string, error) {
+	h := hash(dim, el)
+	s.RLock()
+	defer s.RUnlock()
+	if _, ok := s.elements[h]; !ok {
+		return map[string]string{}, olap.ErrElementNotFound
+	}
+	attrs := make(map[string]string, len(s.attributes[h]))
+	for k, v := range s.attributes[h] {
+		attrs[k] = v
+	}
+	return attrs, nil
+}
+
+func (s *elements) setOrdinal(dim, el string, ordinal int) error {
+	h := hash(dim, el)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.elements[h]; !ok {
+		return olap.ErrElementNotFound
+	}
+	err := s.wal.log(walRecord{
+		Op:      "SetElementOrdinal",
+		Element: &olap.Element{Dimension: dim, Name: el},
+		Ordinal: ordinal,
+	})
+	if err != nil {
+		return err
+	}
+	s.ordinals[h] = ordinal
+	return nil
+}
+
+// sort orders els by ordinal, then by name. The caller must hold the lock.
+func (s *elements) sort(els []olap.Element) {
+	sort.SliceStable(els, func(i, j int) bool {
+		oi, iok := s.ordinals[hash(els[i].Dimension, els[i].Name)]
+		oj, jok := s.ordinals[hash(els[j].Dimension, els[j].Name)]
+		switch {
+		case iok && jok && oi != oj:
+			return oi < oj
+		case iok != jok:
+			return iok
+		}
+		return els[i].Name < els[j].Name
+	})
+}
+
+// snapshot returns the elements of dim in ordinal order with their
+// ordinals and attributes.
+func (s *elements) snapshot(dim string) []snapshotElement {
+	s.RLock()
+	defer s.RUnlock()
+	els := []snapshotElement{}
+	for _, e := range s.listLocked(dim) {
+		h := hash(e.Dimension, e.Name)
+		el := snapshotElement{Element: e}
+		if ordinal, ok := s.ordinals[h]; ok {
+			el.Ordinal = &ordinal
+		}
+		if attrs := s.attributes[h]; len(attrs) > 0 {
+			el.Attributes = make(map[string]string, len(attrs))
+			for k, v := range attrs {
+				el.Attributes[k] = v
+			}
+		}
+		els = append(els, el)
+	}
+	return els
+}
+
+// list returns the elements of dim in ordinal order.
+func (s *elements) list(dim string) []olap.Element {
+	s.RLock()
+	defer s.RUnlock()
+	return s.listLocked(dim)
+}
+
+// listLocked is list for callers that already hold the lock.
+func (s *elements) listLocked(dim string) []olap.Element {
+	els := []olap.Element{}
+	for _, e := range s.elements {
+		if e.Dimension == dim {
+			els = append(els, e)
+		}
+	}
+	s.sort(els)
+	return els
+}
+
+func (s *elements) exist(dim string, names []string) map[string]bool {
+	found := make(map[string]bool, len(names))
+	s.RLock()
+	defer s.RUnlock()
+	for _, name := range names {
+		_, found[name] = s.elements[hash(dim, name)]
+	}
+	return found
+}
+
+func (s *elements) len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.elements)
+}
+
+func (s *elements) sizes() map[string]int {
+	s.RLock()
+	defer s.RUnlock()
+	sizes := map[string]int{}
+	for _, e := range s.elements {
+		sizes[e.Dimension]++
+	}
+	return sizes
+}
+
 func (s *elements) addComponent(tot, el olap.Element) error {
+	return s.addComponentIn(defaultHierarchy, tot, el)
+}
+
+func (s *elements) addComponentIn(hierarchy string, tot, el olap.Element) error {
 	ht := hash(tot.Dimension, tot.Name)
 	he := hash(el.Dimension, el.Name)
-	s.Lock()
-	defer s.Unlock()
-	if _, ok := s.components[ht]; !ok {
-		s.components[ht] = []string{}
+	if _, err := s.getElement(tot.Dimension, tot.Name); err != nil {
+		return &KeyError{Op: "add component", Dim: tot.Dimension, Name: tot.Name, Err: err}
+	}
+	if _, err := s.getElement(el.Dimension, el.Name); err != nil {
+		return &KeyError{Op: "add component", Dim: el.Dimension, Name: el.Name, Err: err}
 	}
-	for _, hx := range s.components[ht] {
+	s.hmu.Lock()
+	defer s.hmu.Unlock()
+	for _, hx := range s.components[hierarchy][ht] {
 		if he == hx {
-			return olap.ErrComponentAlreadyExists
+			return &KeyError{Op: "add component", Dim: el.Dimension, Name: el.Name, Err: olap.ErrComponentAlreadyExists}
+		}
+	}
+	if err := s.wal.log(walRecord{Op: "AddComponent", Hierarchy: hierarchy, Parent: &tot, Element: &el}); err != nil {
+		return err
+	}
+	if _, ok := s.components[hierarchy]; !ok {
+		s.components[hierarchy] = map[string][]string{}
+	}
+	s.components[hierarchy][ht] = append(s.components[hierarchy][ht], he)
+	if _, ok := s.parents[hierarchy]; !ok {
+		s.parents[hierarchy] = map[string][]string{}
+	}
+	s.parents[hierarchy][he] = append(s.parents[hierarchy][he], ht)
+	s.dims[ht] = tot.Dimension
+	s.dims[he] = el.Dimension
+	s.versions[tot.Dimension]++
+	return nil
+}
+
+// detach removes the element from the component lists of all its
+// parents in every hierarchy. A parent left without components becomes
+// a leaf.
+func (s *elements) detach(dim, name string) error {
+	h := hash(dim, name)
+	el, err := s.getElement(dim, name)
+	if err != nil {
+		return err
+	}
+	s.hmu.Lock()
+	defer s.hmu.Unlock()
+	root := true
+	for _, parents := range s.parents {
+		if len(parents[h]) > 0 {
+			root = false
+		}
+	}
+	if root {
+		return nil
+	}
+	if err := s.wal.log(walRecord{Op: "DetachElement", Element: &el}); err != nil {
+		return err
+	}
+	for hierarchy, parents := range s.parents {
+		for _, hp := range parents[h] {
+			comps := s.components[hierarchy]
+			rest := []string{}
+			for _, k := range comps[hp] {
+				if k != h {
+					rest = append(rest, k)
+				}
+			}
+			if len(rest) == 0 {
+				delete(comps, hp)
+			} else {
+				comps[hp] = rest
+			}
+			delete(s.weights, hash(hp, h))
+			s.versions[s.dims[hp]]++
 		}
+		delete(parents, h)
 	}
-	s.components[ht] = append(s.components[ht], he)
+	return nil
+}
+
+// weight returns the weight of child in the parent consolidation. The
+// caller must hold hmu.
+func (s *elements) weight(parent, child string) float64 {
+	if w, ok := s.weights[hash(parent, child)]; ok {
+		return w
+	}
+	return 1
+}
+
+// hasComponent reports whether child is a component of parent in the
+// default hierarchy. The caller must hold hmu.
+func (s *elements) hasComponent(parent, child string) bool {
+	for _, k := range s.components[defaultHierarchy][parent] {
+		if k == child {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *elements) getWeight(parentDim, parent, childDim, child string) (float64, error) {
+	hp := hash(parentDim, parent)
+	hc := hash(childDim, child)
+	s.hmu.RLock()
+	defer s.hmu.RUnlock()
+	if !s.hasComponent(hp, hc) {
+		return 0, olap.ErrComponentNotFound
+	}
+	return s.weight(hp, hc), nil
+}
+
+func (s *elements) setWeight(parentDim, parent, childDim, child string, weight float64) error {
+	hp := hash(parentDim, parent)
+	hc := hash(childDim, child)
+	s.hmu.Lock()
+	defer s.hmu.Unlock()
+	if !s.hasComponent(hp, hc) {
+		return olap.ErrComponentNotFound
+	}
+	err := s.wal.log(walRecord{
+		Op:      "SetComponentWeight",
+		Parent:  &olap.Element{Dimension: parentDim, Name: parent},
+		Element: &olap.Element{Dimension: childDim, Name: child},
+		Weight:  weight,
+	})
+	if err != nil {
+		return err
+	}
+	s.weights[hash(hp, hc)] = weight
+	s.versions[parentDim]++
 	return nil
 }
 
 func (s *elements) getComponent(dim, name string) (olap.Element, error) {
-	s.RLock()
-	defer s.RUnlock()
+	s.rlockAll()
+	defer s.runlockAll()
 	he := hash(dim, name)
-	if _, ok := s.components[he]; ok {
-		return s.elements[he], nil
+	el, ok := s.elements[he]
+	if !ok {
+		return olap.Element{}, olap.ErrElementNotFound
+	}
+	if _, ok := s.components[defaultHierarchy][he]; !ok {
+		return olap.Element{}, olap.ErrComponentNotFound
 	}
-	// TODO: code this
-	panic("not implemented")
+	return el, nil
 }
 
 func (s *elements) children(dim, name string) ([]olap.Element, error) {
+	return s.childrenIn(defaultHierarchy, dim, name)
+}
+
+func (s *elements) childrenIn(hierarchy, dim, name string) ([]olap.Element, error) {
 	h := hash(dim, name)
-	s.RLock()
-	defer s.RUnlock()
-	if _, ok := s.components[h]; !ok {
+	s.rlockAll()
+	defer s.runlockAll()
+	if _, ok := s.elements[h]; !ok {
+		return []olap.Element{}, olap.ErrElementNotFound
+	}
+	comps, ok := s.components[hierarchy][h]
+	if !ok {
 		return []olap.Element{}, olap.ErrComponentNotFound
 	}
 	els := []olap.Element{}
-	for _, k := range s.components[h] {
+	for _, k := range comps {
 		if e, ok := s.elements[k]; ok {
 			els = append(els, e)
 		}
 	}
+	s.sort(els)
 	return els, nil
 }
 
+// edges returns the components of the elements of dim in every
+// hierarchy, sorted by hierarchy and parent.
+func (s *elements) edges(dim string) []snapshotComponent {
+	s.rlockAll()
+	defer s.runlockAll()
+	hierarchies := make([]string, 0, len(s.components))
+	for hierarchy := range s.components {
+		hierarchies = append(hierarchies, hierarchy)
+	}
+	sort.Strings(hierarchies)
+	edges := []snapshotComponent{}
+	for _, hierarchy := range hierarchies {
+		parents := []string{}
+		for h := range s.components[hierarchy] {
+			if s.dims[h] == dim {
+				parents = append(parents, h)
+			}
+		}
+		sort.Strings(parents)
+		for _, h := range parents {
+			for _, k := range s.components[hierarchy][h] {
+				weight := 1.0
+				if hierarchy == defaultHierarchy {
+					weight = s.weight(h, k)
+				}
+				edges = append(edges, snapshotComponent{
+					Hierarchy: hierarchy,
+					Parent:    s.elements[h],
+					Child:     s.elements[k],
+					Weight:    weight,
+				})
+			}
+		}
+	}
+	return edges
+}
+
+func (s *elements) hasComponents(dim string) bool {
+	s.hmu.RLock()
+	defer s.hmu.RUnlock()
+	for _, comps := range s.components {
+		for h := range comps {
+			if s.dims[h] == dim {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leaf is a leaf element with its weight in a consolidation: the sum,
+// over every path that reaches it, of the product of the component
+// weights on the path.
+type leaf struct {
+	name   string
+	weight float64
+}
+
+// leaves returns the distinct elements without components under name in
+// the default hierarchy, in the order they are first reached. A leaf's
+// only leaf is itself, with weight 1. A leaf reachable through several
+// paths, as in a diamond, counts once per path. leaves fails with
+// ErrCyclicHierarchy if it finds a cycle. It also returns the versions
+// of the dimensions of the elements it visited.
+func (s *elements) leaves(dim, name string) ([]leaf, map[string]uint64, error) {
+	h := hash(dim, name)
+	s.rlockAll()
+	defer s.runlockAll()
+	if _, ok := s.elements[h]; !ok {
+		return []leaf{}, nil, olap.ErrElementNotFound
+	}
+	versions := map[string]uint64{}
+	// below memoizes the weighted leaves under each visited element, so
+	// that shared subtrees are walked once.
+	type weighted struct {
+		h      string
+		weight float64
+	}
+	below := map[string][]weighted{}
+	visiting := map[string]bool{}
+	cyclic := false
+	var visit func(h string) []weighted
+	visit = func(h string) []weighted {
+		if visiting[h] {
+			cyclic = true
+			return nil
+		}
+		if ws, ok := below[h]; ok {
+			return ws
+		}
+		d := s.elements[h].Dimension
+		versions[d] = s.versions[d]
+		comps := s.components[defaultHierarchy][h]
+		if len(comps) == 0 {
+			below[h] = []weighted{{h: h, weight: 1}}
+			return below[h]
+		}
+		visiting[h] = true
+		ws := []weighted{}
+		index := map[string]int{}
+		for _, k := range comps {
+			w := s.weight(h, k)
+			for _, l := range visit(k) {
+				i, ok := index[l.h]
+				if !ok {
+					i = len(ws)
+					index[l.h] = i
+					ws = append(ws, weighted{h: l.h})
+				}
+				ws[i].weight += w * l.weight
+			}
+		}
+		visiting[h] = false
+		below[h] = ws
+		return ws
+	}
+	ws := visit(h)
+	if cyclic {
+		return []leaf{}, nil, ErrCyclicHierarchy
+	}
+	leaves := make([]leaf, len(ws))
+	for i, l := range ws {
+		leaves[i] = leaf{name: s.elements[l.h].Name, weight: l.weight}
+	}
+	return leaves, versions, nil
+}
+
+// version returns the versions of dims.
+func (s *elements) version(dims map[string]uint64) map[string]uint64 {
+	s.hmu.RLock()
+	defer s.hmu.RUnlock()
+	versions := make(map[string]uint64, len(dims))
+	for d := range dims {
+		versions[d] = s.versions[d]
+	}
+	return versions
+}
+
+func (s *elements) depth(dim, name string) (int, error) {
+	h := hash(dim, name)
+	s.rlockAll()
+	defer s.runlockAll()
+	if _, ok := s.elements[h]; !ok {
+		return 0, olap.ErrElementNotFound
+	}
+	parents := s.parents[defaultHierarchy]
+	// Look for cycles among the ancestors first, so that a root reachable
+	// through a short path doesn't hide one.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var cyclic func(h string) bool
+	cyclic = func(h string) bool {
+		switch state[h] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[h] = visiting
+		for _, p := range parents[h] {
+			if cyclic(p) {
+				return true
+			}
+		}
+		state[h] = done
+		return false
+	}
+	if cyclic(h) {
+		return 0, ErrCyclicHierarchy
+	}
+	level := []string{h}
+	seen := map[string]bool{h: true}
+	for depth := 0; ; depth++ {
+		next := []string{}
+		for _, k := range level {
+			if len(parents[k]) == 0 {
+				return depth, nil
+			}
+			for _, p := range parents[k] {
+				if !seen[p] {
+					seen[p] = true
+					next = append(next, p)
+				}
+			}
+		}
+		level = next
+	}
+}
+
+// walk visits root and its descendants depth first, in the default
+// hierarchy. An element already on the path from root is reported with
+// cycle set and its components aren't visited again.
+func (s *elements) walk(dim, root string, fn func(el olap.Element, depth int, cycle bool)) error {
+	h := hash(dim, root)
+	s.rlockAll()
+	defer s.runlockAll()
+	if _, ok := s.elements[h]; !ok {
+		return olap.ErrElementNotFound
+	}
+	s.walkFrom(h, 0, map[string]bool{}, fn)
+	return nil
+}
+
+func (s *elements) walkFrom(h string, depth int, path map[string]bool, fn func(olap.Element, int, bool)) {
+	if path[h] {
+		fn(s.elements[h], depth, true)
+		return
+	}
+	fn(s.elements[h], depth, false)
+	path[h] = true
+	for _, k := range s.components[defaultHierarchy][h] {
+		s.walkFrom(k, depth+1, path, fn)
+	}
+	delete(path, h)
+}
+
 type cells struct {
 	sync.RWMutex
 	cells map[string]olap.Cell
+	// cellsByCube indexes cells by cube. It must be kept in sync with
+	// cells under the same lock; use put and remove to mutate both.
+	cellsByCube map[string]map[string]olap.Cell
+	strict      bool
+	wal         *wal
+	// slices counts the changes to each slice of cells, the cells of a
+	// cube that agree on all coordinates but one, keyed by sliceKey. The
+	// aggregation cache uses it; put and remove update it.
+	slices map[string]uint64
 }
 
 func newCells() *cells {
 	return &cells{
-		cells: map[string]olap.Cell{},
+		cells:       map[string]olap.Cell{},
+		cellsByCube: map[string]map[string]olap.Cell{},
+		slices:      map[string]uint64{},
+	}
+}
+
+// version returns the number of changes to the cells of cube at others,
+// with any element at position pos.
+func (s *cells) version(cube string, pos int, others []string) uint64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.slices[sliceKey(cube, pos, others)]
+}
+
+// touch counts a change to cell in each slice it belongs to. The caller
+// must hold the lock.
+func (s *cells) touch(cell olap.Cell) {
+	for pos := range cell.Elements {
+		s.slices[sliceKey(cell.Cube, pos, without(cell.Elements, pos))]++
+	}
+}
+
+// put logs cell and stores it in both indexes. put and remove change
+// nothing if the log write fails.
+func (s *cells) put(h string, cell olap.Cell) error {
+	if err := s.wal.log(walRecord{Op: "PutCell", Cell: &cell}); err != nil {
+		return err
 	}
+	s.cells[h] = cell
+	if _, ok := s.cellsByCube[cell.Cube]; !ok {
+		s.cellsByCube[cell.Cube] = map[string]olap.Cell{}
+	}
+	s.cellsByCube[cell.Cube][h] = cell
+	s.touch(cell)
+	return nil
+}
+
+func (s *cells) remove(h string) error {
+	c, ok := s.cells[h]
+	if !ok {
+		return nil
+	}
+	if err := s.wal.log(walRecord{Op: "DeleteCell", Cell: &olap.Cell{Cube: c.Cube, Elements: c.Elements}}); err != nil {
+		return err
+	}
+	delete(s.cells, h)
+	delete(s.cellsByCube[c.Cube], h)
+	if len(s.cellsByCube[c.Cube]) == 0 {
+		delete(s.cellsByCube, c.Cube)
+	}
+	s.touch(c)
+	return nil
 }
 
 func (s *cells) addCell(cell olap.Cell) error {
@@ -253,19 +1490,146 @@ func (s *cells) addCell(cell olap.Cell) error {
 	h = hash(cell.Cube, h)
 	s.Lock()
 	defer s.Unlock()
-	s.cells[h] = cell
-	return nil
+	if _, ok := s.cells[h]; ok && s.strict {
+		return ErrCellAlreadyExists
+	}
+	return s.put(h, cell)
 }
 
 func (s *cells) getCell(cube string, elements ...string) (olap.Cell, error) {
+	if c, ok := s.lookup(cube, elements...); ok {
+		return c, nil
+	}
+	return olap.Cell{}, olap.ErrCellNotFound
+}
+
+func (s *cells) lookup(cube string, elements ...string) (olap.Cell, bool) {
 	h := hash(elements...)
 	h = hash(cube, h)
 	s.RLock()
 	defer s.RUnlock()
-	if c, ok := s.cells[h]; ok {
-		return c, nil
+	c, ok := s.cells[h]
+	return c, ok
+}
+
+func (s *cells) replaceCells(cube string, cells []olap.Cell) error {
+	for _, c := range cells {
+		if c.Cube != cube {
+			return ErrCubeMismatch
+		}
 	}
-	return olap.Cell{}, olap.ErrCellNotFound
+	s.Lock()
+	defer s.Unlock()
+	for h := range s.cellsByCube[cube] {
+		if err := s.remove(h); err != nil {
+			return err
+		}
+	}
+	for _, c := range cells {
+		if err := s.put(hash(cube, hash(c.Elements...)), c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cells) clear(cube string) error {
+	s.Lock()
+	defer s.Unlock()
+	for h := range s.cellsByCube[cube] {
+		if err := s.remove(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cells) deleteCell(cube string, elements ...string) error {
+	h := hash(cube, hash(elements...))
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.cells[h]; !ok {
+		return olap.ErrCellNotFound
+	}
+	return s.remove(h)
+}
+
+func (s *cells) deleteByElement(cube string, pos int, element string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	n := 0
+	for h, c := range s.cellsByCube[cube] {
+		if pos < len(c.Elements) && c.Elements[pos] == element {
+			if err := s.remove(h); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *cells) remap(cube string, pos int, from, to string, merge MergePolicy) error {
+	s.Lock()
+	defer s.Unlock()
+	moved := map[string]olap.Cell{}
+	for h, c := range s.cellsByCube[cube] {
+		if pos >= len(c.Elements) || c.Elements[pos] != from {
+			continue
+		}
+		c.Elements = append([]string{}, c.Elements...)
+		c.Elements[pos] = to
+		if _, ok := s.cells[hash(cube, hash(c.Elements...))]; ok && merge == MergeError {
+			return ErrCellAlreadyExists
+		}
+		moved[h] = c
+	}
+	for h, c := range moved {
+		if err := s.remove(h); err != nil {
+			return err
+		}
+		nh := hash(cube, hash(c.Elements...))
+		if old, ok := s.cells[nh]; ok && merge == MergeSum {
+			c.Value += old.Value
+		}
+		if err := s.put(nh, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cells) len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.cells)
+}
+
+func (s *cells) total(cube string) float64 {
+	s.RLock()
+	defer s.RUnlock()
+	var sum float64
+	for _, c := range s.cellsByCube[cube] {
+		sum += c.Value
+	}
+	return sum
+}
+
+func (s *cells) count(cube string) int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.cellsByCube[cube])
+}
+
+func (s *cells) rangeCells(cube string, fn func(olap.Cell) bool) error {
+	s.RLock()
+	defer s.RUnlock()
+	for _, c := range s.cellsByCube[cube] {
+		if !fn(c) {
+			break
+		}
+	}
+	return nil
 }
 
 func hash(words ...string) string {
@@ -0,0 +1,1408 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aclivo/olap"
+)
+
+func newTestStorage() *Storage {
+	return NewFastStorage()
+}
+
+// addDimensions adds the named dimensions to s, skipping existing ones.
+func addDimensions(t testing.TB, s *Storage, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		err := s.AddDimension(context.Background(), olap.Dimension{Name: name})
+		if err != nil && !errors.Is(err, olap.ErrDimensionAlreadyExists) {
+			t.Fatal(err)
+		}
+	}
+}
+
+// addCube adds cube to s along with its dimensions.
+func addCube(t testing.TB, s *Storage, cube olap.Cube) {
+	t.Helper()
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(context.Background(), cube); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(els []olap.Element) []string {
+	ns := []string{}
+	for _, e := range els {
+		ns = append(ns, e.Name)
+	}
+	return ns
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHierarchies(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addDimensions(t, s, "Time")
+	year := olap.Element{Dimension: "Time", Name: "2020"}
+	q1 := olap.Element{Dimension: "Time", Name: "Q1"}
+	fq1 := olap.Element{Dimension: "Time", Name: "FQ1"}
+	for _, el := range []olap.Element{year, q1, fq1} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.AddComponentIn(ctx, "calendar", year, q1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddComponentIn(ctx, "fiscal", year, fq1); err != nil {
+		t.Fatal(err)
+	}
+
+	els, err := s.ChildrenIn(ctx, "calendar", year.Dimension, year.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(els); !equal(got, []string{"Q1"}) {
+		t.Errorf("calendar children = %v", got)
+	}
+
+	els, err = s.ChildrenIn(ctx, "fiscal", year.Dimension, year.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(els); !equal(got, []string{"FQ1"}) {
+		t.Errorf("fiscal children = %v", got)
+	}
+
+	if _, err := s.Children(ctx, year.Dimension, year.Name); err != olap.ErrComponentNotFound {
+		t.Errorf("default children err = %v", err)
+	}
+}
+
+func TestDefaultHierarchy(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addDimensions(t, s, "Product")
+	tot := olap.Element{Dimension: "Product", Name: "vehicles"}
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	for _, el := range []olap.Element{tot, car} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.AddComponent(ctx, tot, car); err != nil {
+		t.Fatal(err)
+	}
+
+	els, err := s.ChildrenIn(ctx, defaultHierarchy, tot.Dimension, tot.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(els); !equal(got, []string{"car"}) {
+		t.Errorf("children = %v", got)
+	}
+}
+
+func TestRangeCells(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	for _, name := range []string{"car", "motorcycle", "truck"} {
+		cell := olap.Cell{Cube: "Sales", Elements: []string{name}, Value: 1}
+		if err := s.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := olap.Cell{Cube: "Costs", Elements: []string{"car"}, Value: 1}
+	if err := s.AddCell(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err := s.RangeCells(ctx, "Sales", func(c olap.Cell) bool {
+		calls++
+		return calls < 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+
+	calls = 0
+	err = s.RangeCells(ctx, "Sales", func(c olap.Cell) bool {
+		if c.Cube != "Sales" {
+			t.Errorf("unexpected cube %q", c.Cube)
+		}
+		calls++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestCubeCopy(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Time"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	cube.Dimensions[0] = "Region"
+
+	got, err := s.GetCube(ctx, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(got.Dimensions, []string{"Product", "Time"}) {
+		t.Fatalf("stored dimensions = %v", got.Dimensions)
+	}
+	got.Dimensions[1] = "Region"
+
+	got, err = s.GetCube(ctx, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(got.Dimensions, []string{"Product", "Time"}) {
+		t.Errorf("stored dimensions = %v", got.Dimensions)
+	}
+}
+
+func TestGetCubeNotFound(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	got, err := s.GetCube(ctx, "Sales")
+	if err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+	if got.Name != "" || len(got.Dimensions) != 0 {
+		t.Errorf("cube = %v, want the zero cube", got)
+	}
+}
+
+func TestDimensionSizes(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	for _, dim := range []string{"Product", "Region", "Empty"} {
+		if err := s.AddDimension(ctx, olap.Dimension{Name: dim}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	els := []olap.Element{
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Product", Name: "motorcycle"},
+		{Dimension: "Product", Name: "truck"},
+		{Dimension: "Region", Name: "north"},
+	}
+	for _, el := range els {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sizes, err := s.DimensionSizes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"Product": 3, "Region": 1, "Empty": 0}
+	if len(sizes) != len(want) {
+		t.Fatalf("sizes = %v, want %v", sizes, want)
+	}
+	for dim, n := range want {
+		if sizes[dim] != n {
+			t.Errorf("sizes[%q] = %d, want %d", dim, sizes[dim], n)
+		}
+	}
+}
+
+func TestCubeDensity(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	els := []olap.Element{
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Product", Name: "motorcycle"},
+		{Dimension: "Region", Name: "north"},
+		{Dimension: "Region", Name: "south"},
+	}
+	for _, el := range els {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Region"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car", "north"}, Value: 1},
+		{Cube: "Sales", Elements: []string{"motorcycle", "south"}, Value: 2},
+		{Cube: "Costs", Elements: []string{"car", "south"}, Value: 3},
+	}
+	for _, cell := range cells {
+		if err := s.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := s.CubeDensity(ctx, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 0.5 {
+		t.Errorf("density = %v, want 0.5", d)
+	}
+
+	empty := olap.Cube{Name: "Empty", Dimensions: []string{"Product", "Nothing"}}
+	addDimensions(t, s, empty.Dimensions...)
+	if err := s.AddCube(ctx, empty); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.CubeDensity(ctx, "Empty"); err != nil || d != 0 {
+		t.Errorf("density = %v, %v, want 0", d, err)
+	}
+
+	if _, err := s.CubeDensity(ctx, "Unknown"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+}
+
+func TestReplaceCells(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	old := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car"}, Value: 1},
+		{Cube: "Sales", Elements: []string{"motorcycle"}, Value: 2},
+		{Cube: "Sales", Elements: []string{"truck"}, Value: 3},
+	}
+	for _, cell := range old {
+		if err := s.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bad := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car"}, Value: 10},
+		{Cube: "Costs", Elements: []string{"car"}, Value: 20},
+	}
+	if err := s.ReplaceCells(ctx, "Sales", bad); err != ErrCubeMismatch {
+		t.Fatalf("err = %v, want %v", err, ErrCubeMismatch)
+	}
+	if n := s.cells.count("Sales"); n != 3 {
+		t.Fatalf("count after failed replace = %d, want 3", n)
+	}
+
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car"}, Value: 10},
+		{Cube: "Sales", Elements: []string{"bike"}, Value: 20},
+	}
+	if err := s.ReplaceCells(ctx, "Sales", cells); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.cells.count("Sales"); n != 2 {
+		t.Errorf("count = %d, want 2", n)
+	}
+	if c, err := s.GetCell(ctx, "Sales", "car"); err != nil || c.Value != 10 {
+		t.Errorf("car = %v, %v", c, err)
+	}
+	if _, err := s.GetCell(ctx, "Sales", "truck"); err != olap.ErrCellNotFound {
+		t.Errorf("truck err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+}
+
+func TestStrictCells(t *testing.T) {
+	ctx := context.Background()
+	cell := olap.Cell{Cube: "Sales", Elements: []string{"car"}, Value: 1}
+	again := olap.Cell{Cube: "Sales", Elements: []string{"car"}, Value: 2}
+
+	s := newTestStorage()
+	addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	if err := s.AddCell(ctx, cell); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCell(ctx, again); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := s.GetCell(ctx, "Sales", "car"); c.Value != 2 {
+		t.Errorf("value = %v, want 2", c.Value)
+	}
+
+	s = NewFastStorage(WithStrictCells(true))
+	addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	if err := s.AddCell(ctx, cell); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCell(ctx, again); err != ErrCellAlreadyExists {
+		t.Errorf("err = %v, want %v", err, ErrCellAlreadyExists)
+	}
+	if c, _ := s.GetCell(ctx, "Sales", "car"); c.Value != 1 {
+		t.Errorf("value = %v, want 1", c.Value)
+	}
+}
+
+func TestKeyError(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	tot := olap.Element{Dimension: "Product", Name: "vehicles"}
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	for _, el := range []olap.Element{tot, car} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddComponent(ctx, tot, car); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		err  error
+		want error
+		dim  string
+		name string
+	}{
+		{s.AddElement(ctx, car), olap.ErrElementAlreadyExists, "Product", "car"},
+		{s.AddComponent(ctx, tot, car), olap.ErrComponentAlreadyExists, "Product", "car"},
+		{s.AddDimension(ctx, olap.Dimension{Name: "Product"}), olap.ErrDimensionAlreadyExists, "Product", ""},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("err = %v, want %v", tt.err, tt.want)
+			continue
+		}
+		var kerr *KeyError
+		if !errors.As(tt.err, &kerr) {
+			t.Errorf("err = %v, want *KeyError", tt.err)
+			continue
+		}
+		if kerr.Dim != tt.dim || kerr.Name != tt.name {
+			t.Errorf("key = %q/%q, want %q/%q", kerr.Dim, kerr.Name, tt.dim, tt.name)
+		}
+	}
+}
+
+func TestStrictCoordinates(t *testing.T) {
+	ctx := context.Background()
+	setup := func(s *Storage) {
+		els := []olap.Element{
+			{Dimension: "Product", Name: "car"},
+			{Dimension: "Region", Name: "north"},
+		}
+		for _, el := range els {
+			if err := s.AddElement(ctx, el); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Region"}}
+		addDimensions(t, s, cube.Dimensions...)
+		if err := s.AddCube(ctx, cube); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestStorage()
+	setup(s)
+	if _, err := s.GetCell(ctx, "Sales", "north", "car"); err != olap.ErrCellNotFound {
+		t.Errorf("lenient err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+
+	s = NewFastStorage(WithStrictCoordinates(true))
+	setup(s)
+	_, err := s.GetCell(ctx, "Sales", "north", "car")
+	if !errors.Is(err, ErrInvalidCoordinate) {
+		t.Fatalf("strict err = %v, want %v", err, ErrInvalidCoordinate)
+	}
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Dim != "Product" || kerr.Name != "north" {
+		t.Errorf("strict err = %v, want Product/north", err)
+	}
+	if _, err := s.GetCell(ctx, "Sales", "car", "north"); err != olap.ErrCellNotFound {
+		t.Errorf("strict err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+}
+
+func TestDumpHierarchy(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	el := func(name string) olap.Element {
+		return olap.Element{Dimension: "Product", Name: name}
+	}
+	for _, name := range []string{"all", "vehicles", "car", "truck", "parts", "wheel"} {
+		if err := s.AddElement(ctx, el(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges := [][2]string{
+		{"all", "vehicles"},
+		{"vehicles", "car"},
+		{"vehicles", "truck"},
+		{"all", "parts"},
+		{"parts", "wheel"},
+		{"wheel", "all"},
+	}
+	for _, e := range edges {
+		if err := s.AddComponent(ctx, el(e[0]), el(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.DumpHierarchy(ctx, "Product", "all", &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `all
+  vehicles
+    car
+    truck
+  parts
+    wheel
+      all (cycle)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := s.DumpHierarchy(ctx, "Product", "bike", &buf); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestIsFlat(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	// Region#Old has a name that starts like Region's element keys.
+	for _, dim := range []string{"Product", "Region", "Region#Old"} {
+		if err := s.AddDimension(ctx, olap.Dimension{Name: dim}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tot := olap.Element{Dimension: "Product", Name: "vehicles"}
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	north := olap.Element{Dimension: "Region", Name: "north"}
+	old := olap.Element{Dimension: "Region#Old", Name: "all"}
+	east := olap.Element{Dimension: "Region#Old", Name: "east"}
+	for _, el := range []olap.Element{tot, car, north, old, east} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddComponent(ctx, tot, car); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddComponent(ctx, old, east); err != nil {
+		t.Fatal(err)
+	}
+
+	if flat, err := s.IsFlat(ctx, "Region"); err != nil || !flat {
+		t.Errorf("Region flat = %v, %v, want true", flat, err)
+	}
+	if flat, err := s.IsFlat(ctx, "Product"); err != nil || flat {
+		t.Errorf("Product flat = %v, %v, want false", flat, err)
+	}
+	if _, err := s.IsFlat(ctx, "Time"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
+
+func TestElementsExist(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"car", "truck"} {
+		if err := s.AddElement(ctx, olap.Element{Dimension: "Product", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := s.ElementsExist(ctx, "Product", []string{"car", "bike", "truck"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"car": true, "bike": false, "truck": true}
+	if len(found) != len(want) {
+		t.Fatalf("found = %v, want %v", found, want)
+	}
+	for name, ok := range want {
+		if found[name] != ok {
+			t.Errorf("found[%q] = %v, want %v", name, found[name], ok)
+		}
+	}
+
+	if _, err := s.ElementsExist(ctx, "Region", []string{"north"}); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
+
+func BenchmarkRangeCells(b *testing.B) {
+	for _, total := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("total=%d", total), func(b *testing.B) {
+			s := newTestStorage()
+			ctx := context.Background()
+			for i := 0; i < total; i++ {
+				cube := "Other"
+				if i < 100 {
+					cube = "Sales"
+				}
+				cell := olap.Cell{Cube: cube, Elements: []string{fmt.Sprint(i)}, Value: 1}
+				if err := s.AddCell(ctx, cell); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := 0
+				err := s.RangeCells(ctx, "Sales", func(olap.Cell) bool {
+					n++
+					return true
+				})
+				if err != nil || n != 100 {
+					b.Fatalf("n = %d, err = %v", n, err)
+				}
+			}
+		})
+	}
+}
+
+func TestElementAttributes(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddElement(ctx, olap.Element{Dimension: "Product", Name: "car"}); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, err := s.GetElementAttributes(ctx, "Product", "car")
+	if err != nil || len(attrs) != 0 {
+		t.Fatalf("attrs = %v, %v, want empty", attrs, err)
+	}
+
+	if err := s.SetElementAttribute(ctx, "Product", "car", "color", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetElementAttribute(ctx, "Product", "car", "wheels", "4"); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err = s.GetElementAttributes(ctx, "Product", "car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 2 || attrs["color"] != "red" || attrs["wheels"] != "4" {
+		t.Fatalf("attrs = %v", attrs)
+	}
+	attrs["color"] = "blue"
+	if attrs, _ := s.GetElementAttributes(ctx, "Product", "car"); attrs["color"] != "red" {
+		t.Errorf("color = %q, want red", attrs["color"])
+	}
+
+	if err := s.SetElementAttribute(ctx, "Product", "bike", "color", "red"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+	if _, err := s.GetElementAttributes(ctx, "Product", "bike"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestGetCellsWildcard(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	els := []olap.Element{
+		{Dimension: "Product", Name: "car"},
+		{Dimension: "Month", Name: "Jan"},
+		{Dimension: "Month", Name: "Feb"},
+		{Dimension: "Month", Name: "Mar"},
+	}
+	for _, el := range els {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Month"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	for i, month := range []string{"Jan", "Feb", "Mar"} {
+		cell := olap.Cell{Cube: "Sales", Elements: []string{"car", month}, Value: float64(i + 1)}
+		if err := s.AddCell(ctx, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cells, err := s.GetCellsWildcard(ctx, "Sales", []string{"car", Wildcard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 3 {
+		t.Fatalf("len(cells) = %d, want 3", len(cells))
+	}
+	var sum float64
+	for _, c := range cells {
+		sum += c.Value
+	}
+	if sum != 6 {
+		t.Errorf("sum = %v, want 6", sum)
+	}
+
+	if _, err := s.GetCellsWildcard(ctx, "Sales", []string{Wildcard, Wildcard}); err != ErrMultipleWildcards {
+		t.Errorf("err = %v, want %v", err, ErrMultipleWildcards)
+	}
+	if _, err := s.GetCellsWildcard(ctx, "Sales", []string{Wildcard}); err != ErrInvalidCoordinate {
+		t.Errorf("err = %v, want %v", err, ErrInvalidCoordinate)
+	}
+}
+
+func TestTryGetCell(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddCell(ctx, olap.Cell{Cube: "Sales", Elements: []string{"car"}, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, ok, err := s.TryGetCell(ctx, "Sales", "car"); err != nil || !ok || c.Value != 1 {
+		t.Errorf("car = %v, %v, %v", c, ok, err)
+	}
+	if _, ok, err := s.TryGetCell(ctx, "Sales", "truck"); err != nil || ok {
+		t.Errorf("truck = %v, %v, want false, nil", ok, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := s.TryGetCell(canceled, "Sales", "car"); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func benchmarkSparse(b *testing.B, get func(s *Storage, ctx context.Context, el string)) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addCube(b, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	for i := 0; i < 1000; i += 100 {
+		cell := olap.Cell{Cube: "Sales", Elements: []string{fmt.Sprint(i)}, Value: 1}
+		if err := s.AddCell(ctx, cell); err != nil {
+			b.Fatal(err)
+		}
+	}
+	els := make([]string, 1000)
+	for i := range els {
+		els[i] = fmt.Sprint(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get(s, ctx, els[i%len(els)])
+	}
+}
+
+func BenchmarkSparseGetCell(b *testing.B) {
+	benchmarkSparse(b, func(s *Storage, ctx context.Context, el string) {
+		if _, err := s.GetCell(ctx, "Sales", el); err != nil && err != olap.ErrCellNotFound {
+			b.Fatal(err)
+		}
+	})
+}
+
+func BenchmarkSparseTryGetCell(b *testing.B) {
+	benchmarkSparse(b, func(s *Storage, ctx context.Context, el string) {
+		if _, _, err := s.TryGetCell(ctx, "Sales", el); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func TestClearCube(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddElement(ctx, olap.Element{Dimension: "Product", Name: "car"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Sales", "Costs"} {
+		cube := olap.Cube{Name: name, Dimensions: []string{"Product"}}
+		addDimensions(t, s, cube.Dimensions...)
+		if err := s.AddCube(ctx, cube); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddCell(ctx, olap.Cell{Cube: name, Elements: []string{"car"}, Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.ClearCube(ctx, "Sales"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetCell(ctx, "Sales", "car"); err != olap.ErrCellNotFound {
+		t.Errorf("Sales err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+	if _, err := s.GetCell(ctx, "Costs", "car"); err != nil {
+		t.Errorf("Costs err = %v", err)
+	}
+	if _, err := s.GetCube(ctx, "Sales"); err != nil {
+		t.Errorf("cube err = %v", err)
+	}
+	if _, err := s.GetElement(ctx, "Product", "car"); err != nil {
+		t.Errorf("element err = %v", err)
+	}
+	if err := s.ClearCube(ctx, "Sales"); err != nil {
+		t.Errorf("clearing an empty cube: %v", err)
+	}
+
+	if err := s.ClearCube(ctx, "Unknown"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+}
+
+func TestListCubesAndDimensions(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	names := []string{"Sales", "Costs", "Budget", "Plan", "Actual"}
+	for _, name := range names {
+		if err := s.AddDimension(ctx, olap.Dimension{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddCube(ctx, olap.Cube{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"Actual", "Budget", "Costs", "Plan", "Sales"}
+
+	for i := 0; i < 2; i++ {
+		cubes, err := s.ListCubes(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, c := range cubes {
+			got = append(got, c.Name)
+		}
+		if !equal(got, want) {
+			t.Errorf("cubes = %v, want %v", got, want)
+		}
+
+		dims, err := s.ListDimensions(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = []string{}
+		for _, d := range dims {
+			got = append(got, d.Name)
+		}
+		if !equal(got, want) {
+			t.Errorf("dimensions = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDeleteCellsByElement(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Month"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	months := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	for _, product := range []string{"car", "truck"} {
+		for _, month := range months {
+			cell := olap.Cell{Cube: "Sales", Elements: []string{product, month}, Value: 1}
+			if err := s.AddCell(ctx, cell); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	n, err := s.DeleteCellsByElement(ctx, "Sales", "Month", "Mar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("deleted = %d, want 2", n)
+	}
+	if got := s.cells.count("Sales"); got != 22 {
+		t.Errorf("count = %d, want 22", got)
+	}
+	if _, err := s.GetCell(ctx, "Sales", "car", "Mar"); err != olap.ErrCellNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+
+	if _, err := s.DeleteCellsByElement(ctx, "Costs", "Month", "Mar"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+	if _, err := s.DeleteCellsByElement(ctx, "Sales", "Region", "north"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+}
+
+func TestElementOrdinals(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addDimensions(t, s, "Month")
+	year := olap.Element{Dimension: "Month", Name: "Year"}
+	if err := s.AddElement(ctx, year); err != nil {
+		t.Fatal(err)
+	}
+	ordinals := map[string]int{"Mar": 3, "Jan": 1, "Feb": 2}
+	for _, name := range []string{"Mar", "Jan", "Feb"} {
+		el := olap.Element{Dimension: "Month", Name: name}
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddComponent(ctx, year, el); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetElementOrdinal(ctx, "Month", name, ordinals[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	els, err := s.ListElements(ctx, "Month")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(els), []string{"Jan", "Feb", "Mar", "Year"}; !equal(got, want) {
+		t.Errorf("elements = %v, want %v", got, want)
+	}
+
+	els, err = s.Children(ctx, "Month", "Year")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(els), []string{"Jan", "Feb", "Mar"}; !equal(got, want) {
+		t.Errorf("children = %v, want %v", got, want)
+	}
+
+	if err := s.SetElementOrdinal(ctx, "Month", "Apr", 4); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestAddComponentMissingElement(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addDimensions(t, s, "Product")
+	tot := olap.Element{Dimension: "Product", Name: "vehicles"}
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	bike := olap.Element{Dimension: "Product", Name: "bike"}
+	parts := olap.Element{Dimension: "Product", Name: "parts"}
+	for _, el := range []olap.Element{tot, car} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		tot, el olap.Element
+		missing string
+	}{
+		{parts, car, "parts"},
+		{tot, bike, "bike"},
+	}
+	for _, tt := range tests {
+		err := s.AddComponent(ctx, tt.tot, tt.el)
+		if !errors.Is(err, olap.ErrElementNotFound) {
+			t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+			continue
+		}
+		var kerr *KeyError
+		if !errors.As(err, &kerr) || kerr.Name != tt.missing {
+			t.Errorf("err = %v, want it to name %q", err, tt.missing)
+		}
+	}
+	if _, err := s.Children(ctx, "Product", "parts"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+
+	if err := s.AddComponent(ctx, tot, car); err != nil {
+		t.Fatal(err)
+	}
+	if els, err := s.Children(ctx, "Product", "vehicles"); err != nil || !equal(names(els), []string{"car"}) {
+		t.Errorf("children = %v, %v", els, err)
+	}
+}
+
+func TestDetachElement(t *testing.T) {
+	var log bytes.Buffer
+	s := NewFastStorage(WithWAL(&log))
+	ctx := context.Background()
+	addDimensions(t, s, "Product")
+	el := func(name string) olap.Element {
+		return olap.Element{Dimension: "Product", Name: name}
+	}
+	for _, name := range []string{"vehicles", "new", "car", "truck", "sedan"} {
+		if err := s.AddElement(ctx, el(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges := [][2]string{
+		{"vehicles", "car"},
+		{"vehicles", "truck"},
+		{"new", "car"},
+		{"car", "sedan"},
+	}
+	for _, e := range edges {
+		if err := s.AddComponent(ctx, el(e[0]), el(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetComponentWeight(ctx, "Product", "vehicles", "Product", "car", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DetachElement(ctx, "Product", "car"); err != nil {
+		t.Fatal(err)
+	}
+	dst := newTestStorage()
+	if err := ReplayWAL(&log, dst); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Storage{s, dst} {
+		if els, err := s.Children(ctx, "Product", "vehicles"); err != nil || !equal(names(els), []string{"truck"}) {
+			t.Errorf("vehicles children = %v, %v, want [truck]", names(els), err)
+		}
+		if _, err := s.Children(ctx, "Product", "new"); err != olap.ErrComponentNotFound {
+			t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+		}
+		if els, err := s.Children(ctx, "Product", "car"); err != nil || !equal(names(els), []string{"sedan"}) {
+			t.Errorf("car children = %v, %v, want [sedan]", names(els), err)
+		}
+		if depth, err := s.ElementDepth(ctx, "Product", "car"); err != nil || depth != 0 {
+			t.Errorf("depth = %d, %v, want 0", depth, err)
+		}
+		if _, err := s.GetComponentWeight(ctx, "Product", "vehicles", "Product", "car"); err != olap.ErrComponentNotFound {
+			t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+		}
+	}
+
+	if err := s.DetachElement(ctx, "Product", "car"); err != nil {
+		t.Errorf("detaching a root: %v", err)
+	}
+	if err := s.DetachElement(ctx, "Product", "bike"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestGetComponent(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	tot := olap.Element{Dimension: "Product", Name: "vehicles"}
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	for _, el := range []olap.Element{tot, car} {
+		if err := s.AddElement(ctx, el); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddComponent(ctx, tot, car); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := s.GetComponent(ctx, "Product", "vehicles"); err != nil || got != tot {
+		t.Errorf("GetComponent(vehicles) = %v, %v, want %v", got, err, tot)
+	}
+	if _, err := s.GetComponent(ctx, "Product", "car"); err != olap.ErrComponentNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrComponentNotFound)
+	}
+	if _, err := s.GetComponent(ctx, "Product", "bike"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestChildrenErrors(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addDimensions(t, s, "Product")
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	if err := s.AddElement(ctx, car); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dim, name string
+		err       error
+	}{
+		{"Region", "north", olap.ErrDimensionNotFound},
+		{"Product", "bike", olap.ErrElementNotFound},
+		{"Product", "car", olap.ErrComponentNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Children(ctx, tt.dim, tt.name); err != tt.err {
+			t.Errorf("Children(%s, %s) err = %v, want %v", tt.dim, tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestGetCubeDimensions(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Month"}}
+	addDimensions(t, s, cube.Dimensions...)
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+
+	dims, err := s.GetCubeDimensions(ctx, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(dims, []string{"Product", "Month"}) {
+		t.Fatalf("dimensions = %v", dims)
+	}
+	dims[0] = "Region"
+	if dims, _ := s.GetCubeDimensions(ctx, "Sales"); !equal(dims, []string{"Product", "Month"}) {
+		t.Errorf("stored dimensions = %v", dims)
+	}
+
+	if _, err := s.GetCubeDimensions(ctx, "Costs"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+}
+
+func TestRemapElement(t *testing.T) {
+	ctx := context.Background()
+	setup := func() *Storage {
+		s := newTestStorage()
+		for _, name := range []string{"north", "south", "east"} {
+			if err := s.AddElement(ctx, olap.Element{Dimension: "Region", Name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Region"}}
+		addDimensions(t, s, cube.Dimensions...)
+		if err := s.AddCube(ctx, cube); err != nil {
+			t.Fatal(err)
+		}
+		cells := []olap.Cell{
+			{Cube: "Sales", Elements: []string{"car", "north"}, Value: 1},
+			{Cube: "Sales", Elements: []string{"truck", "north"}, Value: 2},
+			{Cube: "Sales", Elements: []string{"car", "south"}, Value: 10},
+		}
+		for _, cell := range cells {
+			if err := s.AddCell(ctx, cell); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	}
+	value := func(s *Storage, els ...string) float64 {
+		c, err := s.GetCell(ctx, "Sales", els...)
+		if err != nil {
+			t.Fatalf("%v: %v", els, err)
+		}
+		return c.Value
+	}
+
+	tests := []struct {
+		merge MergePolicy
+		car   float64
+	}{
+		{MergeOverwrite, 1},
+		{MergeSum, 11},
+	}
+	for _, tt := range tests {
+		s := setup()
+		if err := s.RemapElement(ctx, "Sales", "Region", "north", "south", tt.merge); err != nil {
+			t.Fatal(err)
+		}
+		if got := value(s, "car", "south"); got != tt.car {
+			t.Errorf("policy %d: car/south = %v, want %v", tt.merge, got, tt.car)
+		}
+		if got := value(s, "truck", "south"); got != 2 {
+			t.Errorf("policy %d: truck/south = %v, want 2", tt.merge, got)
+		}
+		if n := s.cells.count("Sales"); n != 2 {
+			t.Errorf("policy %d: count = %d, want 2", tt.merge, n)
+		}
+	}
+
+	s := setup()
+	if err := s.RemapElement(ctx, "Sales", "Region", "north", "south", MergeError); err != ErrCellAlreadyExists {
+		t.Errorf("err = %v, want %v", err, ErrCellAlreadyExists)
+	}
+	if got := value(s, "car", "north"); got != 1 {
+		t.Errorf("car/north = %v, want 1", got)
+	}
+	if got := value(s, "car", "south"); got != 10 {
+		t.Errorf("car/south = %v, want 10", got)
+	}
+	if err := s.RemapElement(ctx, "Sales", "Region", "north", "east", MergeError); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if err := s.RemapElement(ctx, "Sales", "Region", "north", "west", MergeError); !errors.Is(err, olap.ErrElementNotFound) {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if empty, err := s.IsEmpty(ctx); err != nil || !empty {
+		t.Errorf("fresh storage empty = %v, %v, want true", empty, err)
+	}
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+	if empty, err := s.IsEmpty(ctx); err != nil || empty {
+		t.Errorf("empty = %v, %v, want false", empty, err)
+	}
+}
+
+func TestElementDepth(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	el := func(name string) olap.Element {
+		return olap.Element{Dimension: "Product", Name: name}
+	}
+	for _, name := range []string{"all", "vehicles", "car", "cars", "x", "y"} {
+		if err := s.AddElement(ctx, el(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges := [][2]string{
+		{"all", "vehicles"},
+		{"vehicles", "car"},
+		{"cars", "car"},
+		{"all", "cars"},
+		{"x", "y"},
+		{"y", "x"},
+	}
+	for _, e := range edges {
+		if err := s.AddComponent(ctx, el(e[0]), el(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		depth int
+	}{
+		{"all", 0},
+		{"vehicles", 1},
+		{"car", 2},
+	}
+	for _, tt := range tests {
+		got, err := s.ElementDepth(ctx, "Product", tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.depth {
+			t.Errorf("depth(%s) = %d, want %d", tt.name, got, tt.depth)
+		}
+	}
+
+	if _, err := s.ElementDepth(ctx, "Product", "x"); err != ErrCyclicHierarchy {
+		t.Errorf("err = %v, want %v", err, ErrCyclicHierarchy)
+	}
+	if _, err := s.ElementDepth(ctx, "Product", "bike"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestSubtreeSize(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	el := func(name string) olap.Element {
+		return olap.Element{Dimension: "Product", Name: name}
+	}
+	for _, name := range []string{"all", "left", "right", "shared", "x", "y"} {
+		if err := s.AddElement(ctx, el(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges := [][2]string{
+		{"all", "left"},
+		{"all", "right"},
+		{"left", "shared"},
+		{"right", "shared"},
+		{"x", "y"},
+		{"y", "x"},
+	}
+	for _, e := range edges {
+		if err := s.AddComponent(ctx, el(e[0]), el(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		root string
+		size int
+	}{
+		{"all", 4},
+		{"left", 2},
+		{"shared", 1},
+	}
+	for _, tt := range tests {
+		got, err := s.SubtreeSize(ctx, "Product", tt.root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.size {
+			t.Errorf("SubtreeSize(%s) = %d, want %d", tt.root, got, tt.size)
+		}
+	}
+
+	// Children from other dimensions are counted by dimension and name.
+	mixed := []olap.Element{
+		{Dimension: "P", Name: "x"},
+		{Dimension: "Q", Name: "x"},
+	}
+	for _, child := range mixed {
+		if err := s.AddElement(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddComponent(ctx, el("shared"), child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := s.SubtreeSize(ctx, "Product", "shared"); err != nil || got != 3 {
+		t.Errorf("SubtreeSize(shared) = %d, %v, want 3", got, err)
+	}
+
+	if _, err := s.SubtreeSize(ctx, "Product", "x"); err != ErrCyclicHierarchy {
+		t.Errorf("err = %v, want %v", err, ErrCyclicHierarchy)
+	}
+	if _, err := s.SubtreeSize(ctx, "Product", "bike"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+}
+
+func TestCubesAndDimensionsExist(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCube(ctx, olap.Cube{Name: "Sales"}); err != nil {
+		t.Fatal(err)
+	}
+	check := func(what string, found, want map[string]bool) {
+		if len(found) != len(want) {
+			t.Errorf("%s = %v, want %v", what, found, want)
+			return
+		}
+		for name, ok := range want {
+			if found[name] != ok {
+				t.Errorf("%s[%q] = %v, want %v", what, name, found[name], ok)
+			}
+		}
+	}
+
+	found, err := s.CubesExist(ctx, []string{"Sales", "Costs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("cubes", found, map[string]bool{"Sales": true, "Costs": false})
+
+	found, err = s.DimensionsExist(ctx, []string{"Product", "Region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("dimensions", found, map[string]bool{"Product": true, "Region": false})
+}
+
+func TestAddCubeMissingDimension(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Region"}}
+	err := s.AddCube(ctx, cube)
+	if !errors.Is(err, olap.ErrDimensionNotFound) {
+		t.Fatalf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Dim != "Region" {
+		t.Errorf("err = %v, want it to name Region", err)
+	}
+	if _, err := s.GetCube(ctx, "Sales"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Region"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddElementDuringHierarchyWrite(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+
+	// Hold the hierarchy lock as a component writer would.
+	s.elements.hmu.Lock()
+	defer s.elements.hmu.Unlock()
+	added := make(chan error)
+	go func() {
+		added <- s.AddElement(ctx, olap.Element{Dimension: "Product", Name: "car"})
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AddElement waited on the hierarchy lock")
+	}
+}
+
+func BenchmarkAddElementAndComponent(b *testing.B) {
+	s := newTestStorage()
+	ctx := context.Background()
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&next, 1)
+			tot := olap.Element{Dimension: "Product", Name: fmt.Sprint("tot", n)}
+			el := olap.Element{Dimension: "Product", Name: fmt.Sprint("el", n)}
+			if err := s.AddElement(ctx, tot); err != nil {
+				b.Fatal(err)
+			}
+			if err := s.AddElement(ctx, el); err != nil {
+				b.Fatal(err)
+			}
+			if err := s.AddComponent(ctx, tot, el); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestGetCellUnknownCube(t *testing.T) {
+	s := newTestStorage()
+	ctx := context.Background()
+	addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+
+	if _, err := s.GetCell(ctx, "Sales", "car"); err != olap.ErrCellNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+	if _, err := s.GetCell(ctx, "Costs", "car"); err != olap.ErrCubeNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCubeNotFound)
+	}
+}
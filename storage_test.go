@@ -1,6 +1,7 @@
 package fast_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aclivo/fast"
@@ -14,3 +15,34 @@ func TestStorage(t *testing.T) {
 	}
 	tests.StorageTestSuit(factory, t)
 }
+
+func TestNewFastStorage(t *testing.T) {
+	s := fast.NewFastStorage()
+	ctx := context.Background()
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Product"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCube(ctx, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}}); err != nil {
+		t.Fatal(err)
+	}
+	cubes, err := s.ListCubes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cubes) != 1 || cubes[0].Name != "Sales" {
+		t.Errorf("ListCubes = %v, want [Sales]", cubes)
+	}
+	if empty, err := s.IsEmpty(ctx); err != nil || empty {
+		t.Errorf("IsEmpty = %v, %v, want false", empty, err)
+	}
+}
+
+func TestNewStorageIsStorage(t *testing.T) {
+	var s interface{} = fast.NewStorage()
+	if _, ok := s.(olap.Storage); !ok {
+		t.Errorf("NewStorage() is %T, not an olap.Storage", s)
+	}
+	if _, ok := s.(*fast.Storage); !ok {
+		t.Errorf("NewStorage() is %T, want *fast.Storage", s)
+	}
+}
@@ -0,0 +1,148 @@
+package fast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aclivo/olap"
+)
+
+// walRecord is one line of the write-ahead log. Op names the change and
+// decides which of the other fields are set.
+type walRecord struct {
+	Op        string          `json:"op"`
+	Cube      *olap.Cube      `json:"cube,omitempty"`
+	Dimension *olap.Dimension `json:"dimension,omitempty"`
+	Hierarchy string          `json:"hierarchy,omitempty"`
+	Parent    *olap.Element   `json:"parent,omitempty"`
+	Element   *olap.Element   `json:"element,omitempty"`
+	Cell      *olap.Cell      `json:"cell,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	Value     string          `json:"value,omitempty"`
+	Ordinal   int             `json:"ordinal,omitempty"`
+	Weight    float64         `json:"weight,omitempty"`
+}
+
+// wal writes records as JSON lines. The stores log each change while
+// holding their own lock and before applying it, so the log follows the
+// order changes were applied in and a change whose record can't be
+// written isn't applied. Like bufio.Writer, the first write error
+// sticks and is returned by every later call. A nil *wal logs nothing.
+type wal struct {
+	sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func newWAL(w io.Writer) *wal {
+	return &wal{enc: json.NewEncoder(w)}
+}
+
+func (w *wal) log(rec walRecord) error {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.err == nil {
+		w.err = w.enc.Encode(rec)
+	}
+	return w.err
+}
+
+// ReplayWAL applies the records of a log written through WithWAL to
+// target. Records beyond olap.Storage, such as attributes or deleted
+// cells, need a target that has the matching fast storage method.
+func ReplayWAL(r io.Reader, target olap.Storage) error {
+	ctx := context.Background()
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec walRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		if err := replay(ctx, rec, target); err != nil {
+			return fmt.Errorf("record %d: %s: %w", n, rec.Op, err)
+		}
+	}
+}
+
+// complete reports whether rec has the fields its op needs.
+func (rec walRecord) complete() bool {
+	switch rec.Op {
+	case "AddCube":
+		return rec.Cube != nil
+	case "AddDimension":
+		return rec.Dimension != nil
+	case "AddElement", "SetElementAttribute", "SetElementOrdinal", "DetachElement":
+		return rec.Element != nil
+	case "AddComponent", "SetComponentWeight":
+		return rec.Parent != nil && rec.Element != nil
+	case "PutCell", "DeleteCell":
+		return rec.Cell != nil
+	}
+	return true
+}
+
+func replay(ctx context.Context, rec walRecord, target olap.Storage) error {
+	if !rec.complete() {
+		return ErrMalformedRecord
+	}
+	switch rec.Op {
+	case "AddCube":
+		return target.AddCube(ctx, *rec.Cube)
+	case "AddDimension":
+		return target.AddDimension(ctx, *rec.Dimension)
+	case "AddElement":
+		return target.AddElement(ctx, *rec.Element)
+	case "AddComponent":
+		if rec.Hierarchy == defaultHierarchy {
+			return target.AddComponent(ctx, *rec.Parent, *rec.Element)
+		}
+		if t, ok := target.(interface {
+			AddComponentIn(context.Context, string, olap.Element, olap.Element) error
+		}); ok {
+			return t.AddComponentIn(ctx, rec.Hierarchy, *rec.Parent, *rec.Element)
+		}
+	case "SetElementAttribute":
+		if t, ok := target.(interface {
+			SetElementAttribute(context.Context, string, string, string, string) error
+		}); ok {
+			return t.SetElementAttribute(ctx, rec.Element.Dimension, rec.Element.Name, rec.Key, rec.Value)
+		}
+	case "SetElementOrdinal":
+		if t, ok := target.(interface {
+			SetElementOrdinal(context.Context, string, string, int) error
+		}); ok {
+			return t.SetElementOrdinal(ctx, rec.Element.Dimension, rec.Element.Name, rec.Ordinal)
+		}
+	case "SetComponentWeight":
+		if t, ok := target.(interface {
+			SetComponentWeight(context.Context, string, string, string, string, float64) error
+		}); ok {
+			return t.SetComponentWeight(ctx, rec.Parent.Dimension, rec.Parent.Name, rec.Element.Dimension, rec.Element.Name, rec.Weight)
+		}
+	case "DetachElement":
+		if t, ok := target.(interface {
+			DetachElement(context.Context, string, string) error
+		}); ok {
+			return t.DetachElement(ctx, rec.Element.Dimension, rec.Element.Name)
+		}
+	case "PutCell":
+		return target.AddCell(ctx, *rec.Cell)
+	case "DeleteCell":
+		if t, ok := target.(interface {
+			DeleteCell(context.Context, string, ...string) error
+		}); ok {
+			return t.DeleteCell(ctx, rec.Cell.Cube, rec.Cell.Elements...)
+		}
+	default:
+		return ErrUnknownRecord
+	}
+	return ErrUnsupportedRecord
+}
@@ -0,0 +1,170 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aclivo/olap"
+)
+
+func TestWALRoundTrip(t *testing.T) {
+	var log bytes.Buffer
+	src := NewFastStorage(WithWAL(&log))
+	ctx := context.Background()
+	el := func(dim, name string) olap.Element {
+		return olap.Element{Dimension: dim, Name: name}
+	}
+
+	for _, dim := range []string{"Product", "Region"} {
+		if err := src.AddDimension(ctx, olap.Dimension{Name: dim}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	els := []olap.Element{
+		el("Product", "vehicles"),
+		el("Product", "car"),
+		el("Product", "truck"),
+		el("Region", "north"),
+		el("Region", "south"),
+	}
+	for _, e := range els {
+		if err := src.AddElement(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.AddComponent(ctx, els[0], els[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.AddComponentIn(ctx, "alt", els[0], els[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetComponentWeight(ctx, "Product", "vehicles", "Product", "car", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetElementAttribute(ctx, "Product", "car", "color", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetElementOrdinal(ctx, "Region", "south", 1); err != nil {
+		t.Fatal(err)
+	}
+	cube := olap.Cube{Name: "Sales", Dimensions: []string{"Product", "Region"}}
+	if err := src.AddCube(ctx, cube); err != nil {
+		t.Fatal(err)
+	}
+	cells := []olap.Cell{
+		{Cube: "Sales", Elements: []string{"car", "north"}, Value: 1},
+		{Cube: "Sales", Elements: []string{"truck", "north"}, Value: 2},
+		{Cube: "Sales", Elements: []string{"car", "south"}, Value: 3},
+	}
+	for _, c := range cells {
+		if err := src.AddCell(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := src.DeleteCellsByElement(ctx, "Sales", "Product", "truck"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.RemapElement(ctx, "Sales", "Region", "south", "north", MergeSum); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestStorage()
+	if err := ReplayWAL(&log, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*Storage{src, dst} {
+		if n := s.cells.count("Sales"); n != 1 {
+			t.Errorf("count = %d, want 1", n)
+		}
+		if c, err := s.GetCell(ctx, "Sales", "car", "north"); err != nil || c.Value != 4 {
+			t.Errorf("car/north = %v, %v, want 4", c.Value, err)
+		}
+		if w, err := s.GetComponentWeight(ctx, "Product", "vehicles", "Product", "car"); err != nil || w != 2 {
+			t.Errorf("weight = %v, %v, want 2", w, err)
+		}
+		if attrs, err := s.GetElementAttributes(ctx, "Product", "car"); err != nil || attrs["color"] != "red" {
+			t.Errorf("attributes = %v, %v", attrs, err)
+		}
+		if regions, err := s.ListElements(ctx, "Region"); err != nil || !equal(names(regions), []string{"south", "north"}) {
+			t.Errorf("regions = %v, %v", names(regions), err)
+		}
+		if children, err := s.ChildrenIn(ctx, "alt", "Product", "vehicles"); err != nil || !equal(names(children), []string{"truck"}) {
+			t.Errorf("alt children = %v, %v", names(children), err)
+		}
+	}
+}
+
+// failingWriter accepts n writes and fails the rest.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestWALWriteError(t *testing.T) {
+	s := NewFastStorage(WithWAL(&failingWriter{n: 3}))
+	ctx := context.Background()
+	addCube(t, s, olap.Cube{Name: "Sales", Dimensions: []string{"Product"}})
+	car := olap.Element{Dimension: "Product", Name: "car"}
+	if err := s.AddElement(ctx, car); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddDimension(ctx, olap.Dimension{Name: "Region"}); err == nil {
+		t.Error("AddDimension succeeded with a failing log")
+	}
+	if _, err := s.GetDimension(ctx, "Region"); err != olap.ErrDimensionNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrDimensionNotFound)
+	}
+	if err := s.AddElement(ctx, olap.Element{Dimension: "Product", Name: "truck"}); err == nil {
+		t.Error("AddElement succeeded with a failing log")
+	}
+	if _, err := s.GetElement(ctx, "Product", "truck"); err != olap.ErrElementNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrElementNotFound)
+	}
+	if err := s.SetElementAttribute(ctx, "Product", "car", "color", "red"); err == nil {
+		t.Error("SetElementAttribute succeeded with a failing log")
+	}
+	if attrs, err := s.GetElementAttributes(ctx, "Product", "car"); err != nil || len(attrs) != 0 {
+		t.Errorf("attributes = %v, %v, want none", attrs, err)
+	}
+	if err := s.AddCell(ctx, olap.Cell{Cube: "Sales", Elements: []string{"car"}, Value: 1}); err == nil {
+		t.Error("AddCell succeeded with a failing log")
+	}
+	if _, err := s.GetCell(ctx, "Sales", "car"); err != olap.ErrCellNotFound {
+		t.Errorf("err = %v, want %v", err, olap.ErrCellNotFound)
+	}
+}
+
+func TestReplayWALMalformed(t *testing.T) {
+	tests := []struct {
+		log  string
+		want error
+	}{
+		{`{"op":"AddCube"}`, ErrMalformedRecord},
+		{`{"op":"AddComponent","parent":{"Name":"vehicles","Dimension":"Product"}}`, ErrMalformedRecord},
+		{`{"op":"PutCell"}`, ErrMalformedRecord},
+		{`{"op":"Compact"}`, ErrUnknownRecord},
+	}
+	for _, tt := range tests {
+		log := `{"op":"AddDimension","dimension":{"Name":"Product"}}` + "\n" + tt.log
+		err := ReplayWAL(strings.NewReader(log), newTestStorage())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("ReplayWAL(%s) = %v, want %v", tt.log, err, tt.want)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "record 2: ") {
+			t.Errorf("err = %q, want it to name record 2", err)
+		}
+	}
+}